@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"synthema/internal/adapters/postgres"
 	"synthema/internal/bootstrap"
 )
 
@@ -40,6 +41,7 @@ func main() {
 		if app.DB != nil {
 			_ = app.DB.Close()
 		}
+		_ = postgres.Close(app.Pool)
 		_ = os.Stdout.Sync()
 		t := time.NewTimer(100 * time.Millisecond)
 		<-t.C
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"synthema/internal/adapters/postgres"
+	"synthema/internal/app/export"
+	"synthema/internal/bootstrap"
+	"synthema/internal/domain/traffic"
+)
+
+// runExport writes one session to a file or standard output:
+//
+//	synthema-capture export [-format har|jsonl] [-o FILE] SESSION_ID
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	formatFlag := fs.String("format", "har", "export format: har or jsonl")
+	outFlag := fs.String("o", "-", "output file, - for standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: synthema-capture export [-format har|jsonl] [-o FILE] SESSION_ID")
+	}
+	format, err := export.ParseFormat(*formatFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app, err := bootstrap.BootstrapExport()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		_ = postgres.Close(app.Pool)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var w io.Writer = os.Stdout
+	if *outFlag != "-" {
+		f, err := os.Create(*outFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := app.Exporter.Export(ctx, w, traffic.SessionID(fs.Arg(0)), format); err != nil {
+		app.Logger.Error(err.Error())
+		_ = postgres.Close(app.Pool)
+		os.Exit(1)
+	}
+}
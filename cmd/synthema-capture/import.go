@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"synthema/internal/adapters/accesslog"
+	"synthema/internal/adapters/postgres"
+	"synthema/internal/app/importer"
+	"synthema/internal/bootstrap"
+)
+
+type importFunc func(ctx context.Context, app bootstrap.ImportApp, r io.Reader) (importer.Result, error)
+
+func importHAR(ctx context.Context, app bootstrap.ImportApp, r io.Reader) (importer.Result, error) {
+	return app.Importer.ImportHAR(ctx, r)
+}
+
+// runImportLog imports access logs:
+//
+//	synthema-capture import-log [-format nginx|envoy] [-pattern P] [-session-key K] [-host H] [-scheme S] FILE...
+//
+// Flags left empty fall back to the SYNTHEMA_IMPORT_* settings.
+func runImportLog(args []string) {
+	fs := flag.NewFlagSet("import-log", flag.ExitOnError)
+	formatFlag := fs.String("format", "", "log format: nginx or envoy")
+	patternFlag := fs.String("pattern", "", "nginx log_format template, or envoy field mapping")
+	sessionKeyFlag := fs.String("session-key", "", "client_ip or header:<Name>")
+	hostFlag := fs.String("host", "", "host for logs that do not record one")
+	schemeFlag := fs.String("scheme", "", "scheme for logs that do not record one")
+	_ = fs.Parse(args)
+
+	runImport(fs.Args(), func(ctx context.Context, app bootstrap.ImportApp, r io.Reader) (importer.Result, error) {
+		cfg := app.Config.Import
+		parser, err := accesslog.NewParser(orDefault(*formatFlag, cfg.LogFormat), orDefault(*patternFlag, cfg.LogPattern))
+		if err != nil {
+			return importer.Result{}, err
+		}
+		return app.Importer.ImportAccessLog(ctx, r, parser, importer.AccessLogOptions{
+			SessionKey:         orDefault(*sessionKeyFlag, cfg.SessionKey),
+			SessionIdleTimeout: app.Config.Capture.SessionIdleTimeout,
+			Host:               orDefault(*hostFlag, cfg.Host),
+			Scheme:             orDefault(*schemeFlag, cfg.Scheme),
+		})
+	})
+}
+
+func orDefault(v, def string) string {
+	if v != "" {
+		return v
+	}
+	return def
+}
+
+// runImport imports each file named in args; "-" reads standard input.
+func runImport(args []string, fn importFunc) {
+	if len(args) == 0 {
+		log.Fatal("usage: synthema-capture import-<format> FILE...")
+	}
+
+	app, err := bootstrap.BootstrapImport()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		_ = postgres.Close(app.Pool)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	for _, name := range args {
+		res, err := importFile(ctx, app, name, fn)
+		if err != nil {
+			app.Logger.Error(fmt.Sprintf("import %s: %v", name, err))
+			_ = postgres.Close(app.Pool)
+			os.Exit(1)
+		}
+		app.Logger.Info(fmt.Sprintf("imported %s: %d requests in %d sessions, %d skipped", name, res.Requests, res.Sessions, res.Skipped))
+	}
+}
+
+func importFile(ctx context.Context, app bootstrap.ImportApp, name string, fn importFunc) (importer.Result, error) {
+	if name == "-" {
+		return fn(ctx, app, os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return importer.Result{}, err
+	}
+	defer f.Close()
+	return fn(ctx, app, f)
+}
@@ -1,16 +1,70 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"synthema/internal/adapters/postgres"
 	"synthema/internal/bootstrap"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import-har":
+			runImport(os.Args[2:], importHAR)
+			return
+		case "import-log":
+			runImportLog(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "proxy":
+		default:
+			log.Fatalf("unknown command: %s", os.Args[1])
+		}
+	}
+	runProxy()
+}
+
+func runProxy() {
 	app, err := bootstrap.BootstrapCapture()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	app.Logger.Info("bootstrap complete")
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		_ = app.Policies.Run(ctx)
+	}()
+
+	serviceCtx, cancelService := context.WithCancel(context.Background())
+	serviceDone := make(chan error, 1)
+	go func() {
+		serviceDone <- app.Service.Run(serviceCtx)
+	}()
+
+	serverErr := app.Server.Run(ctx)
+
+	// The proxy has stopped accepting requests; let the service flush what
+	// is still buffered before exiting.
+	cancelService()
+	if err := <-serviceDone; err != nil {
+		app.Logger.Error(err.Error())
+	}
+	if app.Redis != nil {
+		_ = app.Redis.Close()
+	}
+	_ = postgres.Close(app.Pool)
+	if serverErr != nil {
+		log.Fatal(serverErr)
+	}
 }
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	"synthema/internal/adapters/postgres"
 	"synthema/internal/bootstrap"
 )
 
@@ -13,4 +18,35 @@ func main() {
 	}
 
 	app.Logger.Info("bootstrap complete")
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Ingest and replay share the process; either failing stops both.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// Run returns only after in-flight batches have been written and
+		// acknowledged.
+		if err := app.Ingest.Run(ctx); err != nil {
+			app.Logger.Error(err.Error())
+			stop()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// Tasks interrupted by shutdown are queued again for another worker.
+		if err := app.Replay.Run(ctx); err != nil {
+			app.Logger.Error(err.Error())
+			stop()
+		}
+	}()
+	wg.Wait()
+
+	app.Logger.Info("worker stopped")
+	if app.Redis != nil {
+		_ = app.Redis.Close()
+	}
+	_ = postgres.Close(app.Pool)
 }
@@ -10,6 +10,7 @@ require (
 	github.com/redis/go-redis/v9 v9.7.1
 	github.com/rs/zerolog v1.34.0
 	golang.org/x/crypto v0.47.0
+	google.golang.org/protobuf v1.36.9
 )
 
 require (
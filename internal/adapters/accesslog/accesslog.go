@@ -0,0 +1,49 @@
+package accesslog
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Entry is one access log line reduced to what can be replayed: request
+// line, selected headers, status and timing. Access logs carry no bodies.
+type Entry struct {
+	Time     time.Time
+	Method   string
+	Target   string // request URI: path and optional query
+	Host     string
+	Scheme   string
+	Status   int
+	Bytes    int64
+	Duration time.Duration
+	ClientIP string
+	Headers  http.Header
+}
+
+// Parser turns one log line into an Entry.
+type Parser interface {
+	Parse(line string) (Entry, error)
+}
+
+// NewParser builds a parser for kind "nginx" or "envoy". For nginx, format
+// is an nginx log_format template and defaults to the combined format; for
+// envoy it is a field mapping, see ParseEnvoyFields.
+func NewParser(kind, format string) (Parser, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", "nginx":
+		if format == "" {
+			format = NginxCombined
+		}
+		return NewNginxParser(format)
+	case "envoy", "envoy-json":
+		fields, err := ParseEnvoyFields(format)
+		if err != nil {
+			return nil, err
+		}
+		return NewEnvoyParser(fields), nil
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", kind)
+	}
+}
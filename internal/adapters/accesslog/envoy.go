@@ -0,0 +1,155 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvoyFields names the JSON keys of an Envoy json_format access log. The
+// defaults follow the field names used in Envoy's documentation examples.
+type EnvoyFields struct {
+	Time     string
+	Method   string
+	Path     string
+	Host     string
+	Status   string
+	Bytes    string
+	Duration string // milliseconds
+	ClientIP string
+	// Headers maps header names to the keys holding their values.
+	Headers map[string]string
+}
+
+func DefaultEnvoyFields() EnvoyFields {
+	return EnvoyFields{
+		Time:     "start_time",
+		Method:   "method",
+		Path:     "path",
+		Host:     "authority",
+		Status:   "response_code",
+		Bytes:    "bytes_sent",
+		Duration: "duration",
+		ClientIP: "downstream_remote_address",
+		Headers: map[string]string{
+			"User-Agent":      "user_agent",
+			"X-Forwarded-For": "x_forwarded_for",
+			"X-Request-Id":    "request_id",
+		},
+	}
+}
+
+// ParseEnvoyFields overrides the defaults with a spec such as
+// "method=http_method,path=uri,header.X-Session-Id=session_id".
+func ParseEnvoyFields(spec string) (EnvoyFields, error) {
+	fields := DefaultEnvoyFields()
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(item, "=")
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		if !ok || name == "" || key == "" {
+			return EnvoyFields{}, fmt.Errorf("envoy field %q must be name=key", item)
+		}
+		if header, ok := strings.CutPrefix(name, "header."); ok {
+			fields.Headers[http.CanonicalHeaderKey(header)] = key
+			continue
+		}
+		switch name {
+		case "time":
+			fields.Time = key
+		case "method":
+			fields.Method = key
+		case "path":
+			fields.Path = key
+		case "host":
+			fields.Host = key
+		case "status":
+			fields.Status = key
+		case "bytes":
+			fields.Bytes = key
+		case "duration":
+			fields.Duration = key
+		case "client_ip":
+			fields.ClientIP = key
+		default:
+			return EnvoyFields{}, fmt.Errorf("unknown envoy field %q", name)
+		}
+	}
+	return fields, nil
+}
+
+type EnvoyParser struct {
+	fields EnvoyFields
+}
+
+func NewEnvoyParser(fields EnvoyFields) *EnvoyParser {
+	return &EnvoyParser{fields: fields}
+}
+
+func (p *EnvoyParser) Parse(line string) (Entry, error) {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return Entry{}, err
+	}
+	get := func(key string) string {
+		switch v := raw[key].(type) {
+		case string:
+			if v == "-" {
+				return ""
+			}
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return ""
+		}
+	}
+
+	f := p.fields
+	e := Entry{
+		Method:   get(f.Method),
+		Target:   get(f.Path),
+		Host:     get(f.Host),
+		ClientIP: get(f.ClientIP),
+		Headers:  make(http.Header),
+	}
+	if e.Method == "" || e.Target == "" {
+		return Entry{}, errors.New("line has no method or path")
+	}
+	if host, _, err := net.SplitHostPort(e.ClientIP); err == nil {
+		e.ClientIP = host
+	}
+
+	var err error
+	if e.Time, err = time.Parse(time.RFC3339Nano, get(f.Time)); err != nil {
+		return Entry{}, fmt.Errorf("time: %w", err)
+	}
+	e.Time = e.Time.UTC()
+	if v := get(f.Status); v != "" {
+		if e.Status, err = strconv.Atoi(v); err != nil {
+			return Entry{}, fmt.Errorf("status: %w", err)
+		}
+	}
+	if v := get(f.Bytes); v != "" {
+		e.Bytes, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if v := get(f.Duration); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil {
+			e.Duration = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	for header, key := range f.Headers {
+		if v := get(key); v != "" {
+			e.Headers.Set(header, v)
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,141 @@
+package accesslog
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NginxCombined is nginx's predefined "combined" log_format.
+const NginxCombined = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+const nginxTimeLocal = "02/Jan/2006:15:04:05 -0700"
+
+var nginxVariable = regexp.MustCompile(`\$(?:\{([a-z0-9_]+)\}|([a-z0-9_]+))`)
+
+// NginxParser matches lines against a log_format template. Every $variable
+// becomes a capture group; $http_* variables are turned into headers.
+type NginxParser struct {
+	re        *regexp.Regexp
+	variables []string
+}
+
+func NewNginxParser(format string) (*NginxParser, error) {
+	var (
+		pattern   strings.Builder
+		variables []string
+		last      int
+	)
+	pattern.WriteString("^")
+	for _, m := range nginxVariable.FindAllStringSubmatchIndex(format, -1) {
+		pattern.WriteString(regexp.QuoteMeta(format[last:m[0]]))
+		var name string
+		if m[2] >= 0 {
+			name = format[m[2]:m[3]]
+		} else {
+			name = format[m[4]:m[5]]
+		}
+		variables = append(variables, name)
+		pattern.WriteString("(.*?)")
+		last = m[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(format[last:]))
+	pattern.WriteString("$")
+	if len(variables) == 0 {
+		return nil, errors.New("nginx log format has no variables")
+	}
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("nginx log format: %w", err)
+	}
+	return &NginxParser{re: re, variables: variables}, nil
+}
+
+func (p *NginxParser) Parse(line string) (Entry, error) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, errors.New("line does not match the log format")
+	}
+	vars := make(map[string]string, len(p.variables))
+	for i, name := range p.variables {
+		if v := m[i+1]; v != "-" {
+			vars[name] = v
+		}
+	}
+
+	e := Entry{
+		Method:   vars["request_method"],
+		Target:   vars["request_uri"],
+		Host:     firstNonEmpty(vars["host"], vars["http_host"], vars["server_name"]),
+		Scheme:   vars["scheme"],
+		ClientIP: vars["remote_addr"],
+		Headers:  make(http.Header),
+	}
+	if req, ok := vars["request"]; ok {
+		fields := strings.Fields(req)
+		if len(fields) < 2 {
+			return Entry{}, fmt.Errorf("malformed request line %q", req)
+		}
+		e.Method, e.Target = fields[0], fields[1]
+	}
+	if e.Target == "" && vars["uri"] != "" {
+		e.Target = vars["uri"]
+		if args := vars["args"]; args != "" {
+			e.Target += "?" + args
+		}
+	}
+	if e.Method == "" || e.Target == "" {
+		return Entry{}, errors.New("log format records neither $request nor $request_method and $request_uri")
+	}
+
+	var err error
+	switch {
+	case vars["time_iso8601"] != "":
+		e.Time, err = time.Parse(time.RFC3339, vars["time_iso8601"])
+	case vars["time_local"] != "":
+		e.Time, err = time.Parse(nginxTimeLocal, vars["time_local"])
+	case vars["msec"] != "":
+		var sec float64
+		sec, err = strconv.ParseFloat(vars["msec"], 64)
+		e.Time = time.UnixMilli(int64(sec * 1000))
+	default:
+		err = errors.New("log format records no time")
+	}
+	if err != nil {
+		return Entry{}, fmt.Errorf("time: %w", err)
+	}
+	e.Time = e.Time.UTC()
+
+	if v := vars["status"]; v != "" {
+		if e.Status, err = strconv.Atoi(v); err != nil {
+			return Entry{}, fmt.Errorf("status: %w", err)
+		}
+	}
+	if v := firstNonEmpty(vars["body_bytes_sent"], vars["bytes_sent"]); v != "" {
+		e.Bytes, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if v := vars["request_time"]; v != "" {
+		if sec, err := strconv.ParseFloat(v, 64); err == nil {
+			e.Duration = time.Duration(sec * float64(time.Second))
+		}
+	}
+	for name, v := range vars {
+		if header, ok := strings.CutPrefix(name, "http_"); ok {
+			e.Headers.Set(strings.ReplaceAll(header, "_", "-"), v)
+		}
+	}
+	return e, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"synthema/internal/domain/common"
+)
+
+const testKey = "abcdef0123456789"
+
+func TestFilesystemStoreLayout(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewFilesystemStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := s.Put(ctx, testKey, []byte("body")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "ab", "cd", testKey))
+	if err != nil {
+		t.Fatalf("blob not at root/ab/cd/<key>: %v", err)
+	}
+	if string(data) != "body" {
+		t.Fatalf("stored %q, want %q", data, "body")
+	}
+	got, err := s.Get(ctx, testKey)
+	if err != nil || string(got) != "body" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+	if ok, err := s.Exists(ctx, testKey); err != nil || !ok {
+		t.Fatalf("Exists = %v, %v", ok, err)
+	}
+}
+
+func TestFilesystemStoreMissing(t *testing.T) {
+	s, err := NewFilesystemStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := s.Get(ctx, testKey); !errors.Is(err, common.ErrNotFound) {
+		t.Fatalf("Get of a missing blob = %v, want ErrNotFound", err)
+	}
+	if ok, err := s.Exists(ctx, testKey); err != nil || ok {
+		t.Fatalf("Exists of a missing blob = %v, %v", ok, err)
+	}
+}
+
+func TestFilesystemStoreRejectsUnsafeKeys(t *testing.T) {
+	s, err := NewFilesystemStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "abc", "../../etc/passwd", "ABCDEF0123456789", "abcdef01/23456789"} {
+		if err := s.Put(context.Background(), key, []byte("x")); !errors.Is(err, common.ErrInvalidInput) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidInput", key, err)
+		}
+	}
+}
+
+// Put writes through a temporary file in the blob's directory and renames
+// it into place, so nothing but the blob is left behind.
+func TestFilesystemStorePutRenamesIntoPlace(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewFilesystemStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("x"), 1<<20)
+	if err := s.Put(context.Background(), testKey, data); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "ab", "cd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != testKey {
+		names := make([]string, len(entries))
+		for i, e := range entries {
+			names[i] = e.Name()
+		}
+		t.Fatalf("directory holds %v, want only the blob", names)
+	}
+	got, err := os.ReadFile(filepath.Join(root, "ab", "cd", testKey))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("blob holds %d bytes, %v; want %d", len(got), err, len(data))
+	}
+}
+
+// Keys are content digests, so a blob that exists is never rewritten.
+func TestFilesystemStorePutKeepsExistingBlob(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewFilesystemStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := s.Put(ctx, testKey, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, testKey, []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, testKey)
+	if err != nil || string(got) != "first" {
+		t.Fatalf("Get = %q, %v; want the first blob", got, err)
+	}
+}
+
+// A write cut short leaves only its temporary file, which readers do not
+// see as the blob.
+func TestFilesystemStoreIgnoresPartialWrites(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewFilesystemStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "ab", "cd")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".tmp-123"), []byte("par"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if ok, err := s.Exists(ctx, testKey); err != nil || ok {
+		t.Fatalf("Exists with only a partial write = %v, %v", ok, err)
+	}
+	if err := s.Put(ctx, testKey, []byte("partial no more")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, testKey)
+	if err != nil || string(got) != "partial no more" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,38 @@
+package blobstore
+
+import (
+	"fmt"
+
+	"synthema/internal/config"
+	"synthema/internal/domain/common"
+	"synthema/internal/ports/blob"
+)
+
+// New builds the blob store selected by cfg.Backend. It returns nil when no
+// backend is configured.
+func New(cfg config.BlobConfig) (blob.Store, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "fs", "filesystem":
+		return NewFilesystemStore(cfg.FSRoot)
+	case "s3":
+		return NewS3Store(cfg)
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", cfg.Backend)
+	}
+}
+
+// validateKey only admits lowercase hex digests, which also keeps keys safe
+// to use as file names and URL path segments.
+func validateKey(key string) error {
+	if len(key) < 8 {
+		return fmt.Errorf("%w: blob key %q", common.ErrInvalidInput, key)
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return fmt.Errorf("%w: blob key %q", common.ErrInvalidInput, key)
+		}
+	}
+	return nil
+}
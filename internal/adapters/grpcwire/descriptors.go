@@ -0,0 +1,94 @@
+package grpcwire
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Descriptors resolves gRPC methods against a FileDescriptorSet, as written
+// by protoc --descriptor_set_out --include_imports.
+type Descriptors struct {
+	files *protoregistry.Files
+}
+
+func LoadDescriptorSet(path string) (*Descriptors, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("descriptor set %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor set %s: %w", path, err)
+	}
+	return &Descriptors{files: files}, nil
+}
+
+// DecodeJSON decodes the request (or response) message of service/method
+// into its canonical JSON form.
+func (d *Descriptors) DecodeJSON(service, method string, response bool, msg []byte) ([]byte, error) {
+	desc, err := d.files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("grpc service %s: %w", service, err)
+	}
+	svc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	m := svc.Methods().ByName(protoreflect.Name(method))
+	if m == nil {
+		return nil, fmt.Errorf("grpc method %s/%s not found", service, method)
+	}
+	msgDesc := m.Input()
+	if response {
+		msgDesc = m.Output()
+	}
+
+	dyn := dynamicpb.NewMessage(msgDesc)
+	if err := proto.Unmarshal(msg, dyn); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", msgDesc.FullName(), err)
+	}
+	return protojson.MarshalOptions{Resolver: dynamicResolver{d.files}}.Marshal(dyn)
+}
+
+// dynamicResolver lets protojson expand google.protobuf.Any fields whose
+// types are only known from the descriptor set.
+type dynamicResolver struct {
+	files *protoregistry.Files
+}
+
+func (r dynamicResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	desc, err := r.files.FindDescriptorByName(name)
+	if err != nil {
+		return protoregistry.GlobalTypes.FindMessageByName(name)
+	}
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, protoregistry.NotFound
+	}
+	return dynamicpb.NewMessageType(md), nil
+}
+
+func (r dynamicResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	return r.FindMessageByName(protoreflect.FullName(url[strings.LastIndex(url, "/")+1:]))
+}
+
+func (r dynamicResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+func (r dynamicResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
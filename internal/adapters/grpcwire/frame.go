@@ -0,0 +1,85 @@
+package grpcwire
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const frameHeaderLen = 5
+
+var ErrNotUnary = errors.New("grpc body does not carry exactly one message")
+
+// IsGRPC reports whether a request or response uses the gRPC wire format.
+// gRPC-Web is not supported.
+func IsGRPC(h http.Header) bool {
+	ct := h.Get("Content-Type")
+	return ct == "application/grpc" || strings.HasPrefix(ct, "application/grpc+") || strings.HasPrefix(ct, "application/grpc;")
+}
+
+// SplitMethod splits a gRPC request path "/pkg.Service/Method".
+func SplitMethod(path string) (service, method string, ok bool) {
+	service, method, ok = strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !ok || service == "" || method == "" || strings.Contains(method, "/") {
+		return "", "", false
+	}
+	return service, method, true
+}
+
+// Unframe returns the single message of a unary call body, decompressing
+// it when the frame is marked compressed and encoding is gzip.
+func Unframe(body []byte, encoding string) ([]byte, error) {
+	if len(body) < frameHeaderLen {
+		return nil, fmt.Errorf("grpc frame: %w", io.ErrUnexpectedEOF)
+	}
+	compressed := body[0] == 1
+	n := binary.BigEndian.Uint32(body[1:frameHeaderLen])
+	if uint64(len(body)-frameHeaderLen) < uint64(n) {
+		return nil, fmt.Errorf("grpc frame: %w", io.ErrUnexpectedEOF)
+	}
+	if len(body)-frameHeaderLen != int(n) {
+		return nil, ErrNotUnary
+	}
+	msg := body[frameHeaderLen:]
+	if !compressed {
+		return msg, nil
+	}
+	if encoding != "gzip" {
+		return nil, fmt.Errorf("unsupported grpc encoding %q", encoding)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// Frame wraps an uncompressed message in a gRPC length-prefixed frame.
+func Frame(msg []byte) []byte {
+	out := make([]byte, frameHeaderLen+len(msg))
+	binary.BigEndian.PutUint32(out[1:frameHeaderLen], uint32(len(msg)))
+	copy(out[frameHeaderLen:], msg)
+	return out
+}
+
+// Status reads grpc-status and grpc-message from the trailers, or from the
+// headers for trailers-only responses. A missing status is reported as -1.
+func Status(header, trailer http.Header) (int, string) {
+	for _, h := range []http.Header{trailer, header} {
+		if v := h.Get("Grpc-Status"); v != "" {
+			code, err := strconv.Atoi(v)
+			if err != nil {
+				return -1, ""
+			}
+			return code, h.Get("Grpc-Message")
+		}
+	}
+	return -1, ""
+}
@@ -0,0 +1,220 @@
+package har
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"synthema/internal/adapters/wsframe"
+	"synthema/internal/domain/traffic"
+)
+
+// CapturedTraffic converts an entry into a captured exchange. Bodies
+// longer than maxBodyBytes are truncated the same way live capture does.
+func (e Entry) CapturedTraffic(maxBodyBytes int64) (traffic.CapturedTraffic, error) {
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return traffic.CapturedTraffic{}, fmt.Errorf("entry url %q: %w", e.Request.URL, err)
+	}
+	if e.Request.Method == "" {
+		return traffic.CapturedTraffic{}, fmt.Errorf("entry %s has no method", e.Request.URL)
+	}
+
+	t := traffic.CapturedTraffic{
+		ID:         traffic.CaptureID(uuid.NewString()),
+		CapturedAt: e.StartedDateTime.UTC(),
+		Method:     e.Request.Method,
+		URL:        e.Request.URL,
+		Request: traffic.Request{
+			Scheme:      u.Scheme,
+			Host:        u.Host,
+			Path:        u.Path,
+			QueryString: u.RawQuery,
+			Headers:     toHeader(e.Request.Headers),
+		},
+		Response: traffic.Response{
+			StatusCode: e.Response.Status,
+			Headers:    toHeader(e.Response.Headers),
+		},
+		Latency: time.Duration(max(e.Time, 0) * float64(time.Millisecond)),
+	}
+	if t.Request.Path == "" {
+		t.Request.Path = "/"
+	}
+	if e.Request.PostData != nil {
+		t.Request.Body = traffic.NewBody([]byte(e.Request.PostData.Text), maxBodyBytes)
+	}
+
+	content := []byte(e.Response.Content.Text)
+	if e.Response.Content.Encoding == "base64" {
+		content, err = base64.StdEncoding.DecodeString(e.Response.Content.Text)
+		if err != nil {
+			return traffic.CapturedTraffic{}, fmt.Errorf("entry %s response content: %w", e.Request.URL, err)
+		}
+	}
+	t.Response.Body = traffic.NewBody(content, maxBodyBytes)
+
+	if len(e.WebSocketMessages) > 0 {
+		t.Protocol = traffic.ProtocolWebSocket
+		upgraded := t.CapturedAt.Add(t.Latency)
+		for _, m := range e.WebSocketMessages {
+			data := []byte(m.Data)
+			if m.Opcode == wsframe.OpBinary {
+				if data, err = base64.StdEncoding.DecodeString(m.Data); err != nil {
+					return traffic.CapturedTraffic{}, fmt.Errorf("entry %s websocket message: %w", e.Request.URL, err)
+				}
+			}
+			dir := traffic.FrameFromServer
+			if m.Type == "send" {
+				dir = traffic.FrameFromClient
+			}
+			at := time.Unix(0, int64(m.Time*float64(time.Second)))
+			t.Frames = append(t.Frames, traffic.Frame{
+				Offset:    max(at.Sub(upgraded), 0),
+				Direction: dir,
+				Opcode:    m.Opcode,
+				// Replaying a truncated client message would send
+				// something else, so frames are always kept whole.
+				Body: traffic.NewBody(data, 0),
+			})
+		}
+	}
+	return t, nil
+}
+
+// NewWebSocketMessages converts the frames of a WebSocket record, given
+// their loaded payloads, into Chrome's message list.
+func NewWebSocketMessages(t traffic.CapturedTraffic, payloads [][]byte) []WebSocketMessage {
+	upgraded := t.CapturedAt.Add(t.Latency)
+	msgs := make([]WebSocketMessage, 0, len(t.Frames))
+	for i, f := range t.Frames {
+		m := WebSocketMessage{
+			Type:   "receive",
+			Time:   float64(upgraded.Add(f.Offset).UnixNano()) / float64(time.Second),
+			Opcode: f.Opcode,
+		}
+		if f.Direction == traffic.FrameFromClient {
+			m.Type = "send"
+		}
+		if i < len(payloads) {
+			if f.Opcode == wsframe.OpBinary {
+				m.Data = base64.StdEncoding.EncodeToString(payloads[i])
+			} else {
+				m.Data = string(payloads[i])
+			}
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs
+}
+
+// NewEntry converts a captured exchange back into a HAR entry. Bodies are
+// passed separately because stored records usually only reference them.
+func NewEntry(t traffic.CapturedTraffic, pageRef string, reqBody, respBody []byte) Entry {
+	e := Entry{
+		PageRef:         pageRef,
+		StartedDateTime: t.CapturedAt,
+		Time:            float64(t.Latency) / float64(time.Millisecond),
+		Request: Request{
+			Method:      t.Method,
+			URL:         entryURL(t),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []Cookie{},
+			Headers:     fromHeader(t.Request.Headers),
+			QueryString: fromQuery(t.Request.QueryString),
+			HeadersSize: -1,
+			BodySize:    t.Request.Body.Size,
+		},
+		Response: Response{
+			Status:      t.Response.StatusCode,
+			StatusText:  http.StatusText(t.Response.StatusCode),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []Cookie{},
+			Headers:     fromHeader(t.Response.Headers),
+			Content: Content{
+				Size:     t.Response.Body.Size,
+				MimeType: t.Response.Headers.Get("Content-Type"),
+			},
+			RedirectURL: t.Response.Headers.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    t.Response.Body.Size,
+		},
+		Timings: Timings{Send: 0, Wait: float64(t.Latency) / float64(time.Millisecond), Receive: 0},
+	}
+	if len(reqBody) > 0 {
+		e.Request.PostData = &PostData{MimeType: t.Request.Headers.Get("Content-Type"), Text: string(reqBody)}
+	}
+	if len(respBody) > 0 {
+		if utf8.Valid(respBody) {
+			e.Response.Content.Text = string(respBody)
+		} else {
+			e.Response.Content.Text = base64.StdEncoding.EncodeToString(respBody)
+			e.Response.Content.Encoding = "base64"
+		}
+	}
+	return e
+}
+
+func entryURL(t traffic.CapturedTraffic) string {
+	if t.URL != "" {
+		return t.URL
+	}
+	u := url.URL{Scheme: t.Request.Scheme, Host: t.Request.Host, Path: t.Request.Path, RawQuery: t.Request.QueryString}
+	return u.String()
+}
+
+func fromHeader(h http.Header) []NameValuePair {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := []NameValuePair{}
+	for _, name := range names {
+		for _, v := range h[name] {
+			pairs = append(pairs, NameValuePair{Name: name, Value: v})
+		}
+	}
+	return pairs
+}
+
+func fromQuery(rawQuery string) []NameValuePair {
+	pairs := []NameValuePair{}
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(part, "=")
+		if uk, err := url.QueryUnescape(k); err == nil {
+			k = uk
+		}
+		if uv, err := url.QueryUnescape(v); err == nil {
+			v = uv
+		}
+		pairs = append(pairs, NameValuePair{Name: k, Value: v})
+	}
+	return pairs
+}
+
+func toHeader(pairs []NameValuePair) http.Header {
+	if len(pairs) == 0 {
+		return nil
+	}
+	h := make(http.Header, len(pairs))
+	for _, p := range pairs {
+		// HTTP/2 pseudo headers (:authority, :path, ...) are not real
+		// headers and cannot be replayed.
+		if len(p.Name) > 0 && p.Name[0] == ':' {
+			continue
+		}
+		h.Add(p.Name, p.Value)
+	}
+	return h
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"synthema/internal/domain/diff"
+	"synthema/internal/domain/replay"
+	"synthema/internal/ports/repository"
+)
+
+type DiffRepository struct {
+	pool *pgxpool.Pool
+}
+
+var _ repository.DiffRepository = (*DiffRepository)(nil)
+
+func NewDiffRepository(pool *pgxpool.Pool) *DiffRepository {
+	return &DiffRepository{pool: pool}
+}
+
+// diffSummary is stored in diff_results.summary.
+type diffSummary struct {
+	Fingerprint string        `json:"fingerprint,omitempty"`
+	Endpoint    string        `json:"endpoint,omitempty"`
+	Changes     []diff.Change `json:"changes,omitempty"`
+	Noise       []string      `json:"noise,omitempty"`
+}
+
+func (r *DiffRepository) SaveDiffResult(ctx context.Context, d diff.DiffResult) error {
+	id, err := parseUUID("diff result id", string(d.ID))
+	if err != nil {
+		return err
+	}
+	resultID, err := parseUUID("replay result id", string(d.ReplayResultID))
+	if err != nil {
+		return err
+	}
+	summary, err := json.Marshal(diffSummary{Fingerprint: d.Fingerprint, Endpoint: d.Endpoint, Changes: d.Changes, Noise: d.Noise})
+	if err != nil {
+		return err
+	}
+	createdAt := d.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+
+	_, err = r.pool.Exec(ctx, `
+		INSERT INTO diff_results (id, replay_result_id, status, diff_strategy, summary, error_message, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+	`, id, resultID, string(d.Status), d.Strategy, summary, nullString(d.ErrorMessage), createdAt)
+	return err
+}
+
+// ListJobDiffResults returns the diff results of a job's requests. A
+// request replayed on several attempts only counts with its last one.
+func (r *DiffRepository) ListJobDiffResults(ctx context.Context, id replay.ReplayID) ([]diff.DiffResult, error) {
+	jobID, err := parseUUID("replay job id", string(id))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT DISTINCT ON (rr.replay_task_id, COALESCE(rr.traffic_request_id, rr.id))
+		       d.id, d.replay_result_id, d.status, d.diff_strategy, d.summary, d.error_message, d.created_at
+		FROM diff_results d
+		JOIN replay_results rr ON rr.id = d.replay_result_id
+		JOIN replay_tasks t ON t.id = rr.replay_task_id
+		WHERE t.replay_job_id = $1
+		ORDER BY rr.replay_task_id, COALESCE(rr.traffic_request_id, rr.id), rr.attempt DESC, rr.finished_at DESC
+	`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []diff.DiffResult
+	for rows.Next() {
+		var (
+			d            diff.DiffResult
+			id, resultID uuid.UUID
+			status       string
+			summary      []byte
+			errorMessage *string
+		)
+		if err := rows.Scan(&id, &resultID, &status, &d.Strategy, &summary, &errorMessage, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		d.ID = diff.DiffID(id.String())
+		d.ReplayResultID = replay.ResultID(resultID.String())
+		d.Status = diff.Status(status)
+		d.ErrorMessage = derefString(errorMessage)
+		if len(summary) > 0 {
+			var sum diffSummary
+			if err := json.Unmarshal(summary, &sum); err != nil {
+				return nil, fmt.Errorf("diff result %s summary: %w", id, err)
+			}
+			d.Fingerprint, d.Endpoint, d.Changes, d.Noise = sum.Fingerprint, sum.Endpoint, sum.Changes, sum.Noise
+		}
+		results = append(results, d)
+	}
+	return results, rows.Err()
+}
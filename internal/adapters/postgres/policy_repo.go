@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"synthema/internal/domain/common"
+	"synthema/internal/domain/traffic"
+	"synthema/internal/ports/repository"
+)
+
+type CapturePolicyRepository struct {
+	pool *pgxpool.Pool
+}
+
+var _ repository.CapturePolicyRepository = (*CapturePolicyRepository)(nil)
+
+func NewCapturePolicyRepository(pool *pgxpool.Pool) *CapturePolicyRepository {
+	return &CapturePolicyRepository{pool: pool}
+}
+
+func (r *CapturePolicyRepository) LoadCapturePolicy(ctx context.Context, environmentID, shadowTargetID string) (traffic.CapturePolicy, error) {
+	envID, err := parseUUID("environment id", environmentID)
+	if err != nil {
+		return traffic.CapturePolicy{}, err
+	}
+
+	var envPolicy []byte
+	err = r.pool.QueryRow(ctx, `
+		SELECT metadata -> 'capture_policy'
+		FROM environments
+		WHERE id = $1 AND deleted_at IS NULL
+	`, envID).Scan(&envPolicy)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return traffic.CapturePolicy{}, fmt.Errorf("environment %s: %w", environmentID, common.ErrNotFound)
+		}
+		return traffic.CapturePolicy{}, err
+	}
+
+	policy, err := decodeCapturePolicy(envPolicy)
+	if err != nil {
+		return traffic.CapturePolicy{}, fmt.Errorf("environment %s: %w", environmentID, err)
+	}
+	if shadowTargetID == "" {
+		return policy, nil
+	}
+
+	targetID, err := parseUUID("shadow target id", shadowTargetID)
+	if err != nil {
+		return traffic.CapturePolicy{}, err
+	}
+	var targetPolicy []byte
+	err = r.pool.QueryRow(ctx, `
+		SELECT config -> 'capture_policy'
+		FROM shadow_targets
+		WHERE id = $1 AND source_environment_id = $2 AND deleted_at IS NULL
+	`, targetID, envID).Scan(&targetPolicy)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return traffic.CapturePolicy{}, fmt.Errorf("shadow target %s for environment %s: %w", shadowTargetID, environmentID, common.ErrNotFound)
+		}
+		return traffic.CapturePolicy{}, err
+	}
+
+	override, err := decodeCapturePolicy(targetPolicy)
+	if err != nil {
+		return traffic.CapturePolicy{}, fmt.Errorf("shadow target %s: %w", shadowTargetID, err)
+	}
+	return policy.Merge(override), nil
+}
+
+func decodeCapturePolicy(raw []byte) (traffic.CapturePolicy, error) {
+	var policy traffic.CapturePolicy
+	if len(raw) == 0 || string(raw) == "null" {
+		return policy, nil
+	}
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return traffic.CapturePolicy{}, fmt.Errorf("%w: capture_policy: %v", common.ErrInvalidInput, err)
+	}
+	return policy, nil
+}
@@ -0,0 +1,870 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"synthema/internal/domain/common"
+	"synthema/internal/domain/replay"
+	"synthema/internal/domain/traffic"
+	"synthema/internal/ports/repository"
+)
+
+type ReplayRepository struct {
+	pool *pgxpool.Pool
+}
+
+var _ repository.ReplayRepository = (*ReplayRepository)(nil)
+
+func NewReplayRepository(pool *pgxpool.Pool) *ReplayRepository {
+	return &ReplayRepository{pool: pool}
+}
+
+const replayJobColumns = `id, project_id, shadow_target_id, transform_rule_set_id, status, params, error_message,
+	summary, schedule_name, scheduled_for, created_at, requested_at, started_at, finished_at`
+
+func (r *ReplayRepository) SaveReplayJob(ctx context.Context, j replay.ReplayJob) error {
+	args, err := replayJobArgs(j)
+	if err != nil {
+		return err
+	}
+	_, err = r.pool.Exec(ctx, insertReplayJob+`
+		ON CONFLICT (id) DO UPDATE
+		SET status = EXCLUDED.status,
+		    started_at = EXCLUDED.started_at,
+		    finished_at = EXCLUDED.finished_at,
+		    params = EXCLUDED.params,
+		    error_message = EXCLUDED.error_message,
+		    updated_at = now()
+	`, args...)
+	return err
+}
+
+// CreateScheduledJob saves a job a schedule started unless one was already
+// saved for the same run, which makes starting it safe from any number of
+// workers. It reports whether the job was saved.
+func (r *ReplayRepository) CreateScheduledJob(ctx context.Context, j replay.ReplayJob) (bool, error) {
+	if j.ScheduleName == "" || j.ScheduledFor == nil {
+		return false, fmt.Errorf("%w: replay job %s has no schedule", common.ErrInvalidInput, j.ID)
+	}
+	args, err := replayJobArgs(j)
+	if err != nil {
+		return false, err
+	}
+	tag, err := r.pool.Exec(ctx, insertReplayJob+` ON CONFLICT DO NOTHING`, args...)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+const insertReplayJob = `
+		INSERT INTO replay_jobs (id, project_id, shadow_target_id, transform_rule_set_id, status, requested_at, started_at, finished_at,
+			params, error_message, schedule_name, scheduled_for)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+func replayJobArgs(j replay.ReplayJob) ([]any, error) {
+	id, err := parseUUID("replay job id", string(j.ID))
+	if err != nil {
+		return nil, err
+	}
+	projectID, err := parseUUID("project id", j.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	targetID, err := parseUUID("shadow target id", j.ShadowTargetID)
+	if err != nil {
+		return nil, err
+	}
+	var ruleSetID *uuid.UUID
+	if j.TransformRuleSetID != "" {
+		id, err := parseUUID("transform rule set id", j.TransformRuleSetID)
+		if err != nil {
+			return nil, err
+		}
+		ruleSetID = &id
+	}
+	params, err := json.Marshal(j.Params)
+	if err != nil {
+		return nil, err
+	}
+	requestedAt := j.RequestedAt
+	if requestedAt.IsZero() {
+		requestedAt = time.Now().UTC()
+	}
+	return []any{id, projectID, targetID, ruleSetID, string(j.Status), requestedAt, j.StartedAt, j.FinishedAt,
+		params, nullString(j.ErrorMessage), nullString(j.ScheduleName), j.ScheduledFor}, nil
+}
+
+func (r *ReplayRepository) GetReplayJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error) {
+	jobID, err := parseUUID("replay job id", string(id))
+	if err != nil {
+		return replay.ReplayJob{}, err
+	}
+	job, err := scanReplayJob(r.pool.QueryRow(ctx, `SELECT `+replayJobColumns+` FROM replay_jobs WHERE id = $1`, jobID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return replay.ReplayJob{}, fmt.Errorf("replay job %s: %w", id, common.ErrNotFound)
+		}
+		return replay.ReplayJob{}, err
+	}
+	return job, nil
+}
+
+func scanReplayJob(row pgx.Row) (replay.ReplayJob, error) {
+	var (
+		job                     replay.ReplayJob
+		id, projectID, targetID uuid.UUID
+		ruleSetID               *uuid.UUID
+		status                  string
+		params, summary         []byte
+		errorMessage, schedule  *string
+	)
+	if err := row.Scan(&id, &projectID, &targetID, &ruleSetID, &status, &params, &errorMessage,
+		&summary, &schedule, &job.ScheduledFor, &job.CreatedAt, &job.RequestedAt, &job.StartedAt, &job.FinishedAt); err != nil {
+		return replay.ReplayJob{}, err
+	}
+	job.ID = replay.ReplayID(id.String())
+	job.ProjectID = projectID.String()
+	job.ShadowTargetID = targetID.String()
+	if ruleSetID != nil {
+		job.TransformRuleSetID = ruleSetID.String()
+	}
+	job.Status = replay.Status(status)
+	job.ErrorMessage = derefString(errorMessage)
+	job.ScheduleName = derefString(schedule)
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &job.Params); err != nil {
+			return replay.ReplayJob{}, fmt.Errorf("replay job %s params: %w", id, err)
+		}
+	}
+	if len(summary) > 0 {
+		job.Summary = new(replay.JobSummary)
+		if err := json.Unmarshal(summary, job.Summary); err != nil {
+			return replay.ReplayJob{}, fmt.Errorf("replay job %s summary: %w", id, err)
+		}
+	}
+	return job, nil
+}
+
+func (r *ReplayRepository) SaveJobSummary(ctx context.Context, id replay.ReplayID, summary replay.JobSummary) error {
+	jobID, err := parseUUID("replay job id", string(id))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	_, err = r.pool.Exec(ctx, `UPDATE replay_jobs SET summary = $2, updated_at = now() WHERE id = $1`, jobID, data)
+	return err
+}
+
+func (r *ReplayRepository) CountTasks(ctx context.Context, id replay.ReplayID) (replay.TaskCounts, error) {
+	jobID, err := parseUUID("replay job id", string(id))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.pool.Query(ctx, `SELECT status, COUNT(*) FROM replay_tasks WHERE replay_job_id = $1 GROUP BY status`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(replay.TaskCounts)
+	for rows.Next() {
+		var (
+			status string
+			n      int
+		)
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[replay.Status(status)] = n
+	}
+	return counts, rows.Err()
+}
+
+const shadowTargetColumns = `st.id, st.project_id, st.source_environment_id, st.target_environment_id, st.status,
+	st.replay_strategy, st.diff_strategy, e.metadata ->> 'base_url', st.config -> 'replay_policy',
+	st.config -> 'baseline_urls', st.config -> 'retry_policy', st.config -> 'schedules'`
+
+func (r *ReplayRepository) GetShadowTarget(ctx context.Context, id string) (replay.ShadowTarget, error) {
+	targetID, err := parseUUID("shadow target id", id)
+	if err != nil {
+		return replay.ShadowTarget{}, err
+	}
+	t, err := scanShadowTarget(r.pool.QueryRow(ctx, `
+		SELECT `+shadowTargetColumns+`
+		FROM shadow_targets st
+		JOIN environments e ON e.id = st.target_environment_id
+		WHERE st.id = $1 AND st.deleted_at IS NULL
+	`, targetID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return replay.ShadowTarget{}, fmt.Errorf("shadow target %s: %w", id, common.ErrNotFound)
+		}
+		return replay.ShadowTarget{}, err
+	}
+	return t, nil
+}
+
+// ListScheduledTargets returns the active shadow targets that have
+// schedules in their config.
+func (r *ReplayRepository) ListScheduledTargets(ctx context.Context) ([]replay.ShadowTarget, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+shadowTargetColumns+`
+		FROM shadow_targets st
+		JOIN environments e ON e.id = st.target_environment_id
+		WHERE st.deleted_at IS NULL AND st.status = 'active' AND st.config ? 'schedules'
+		ORDER BY st.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []replay.ShadowTarget
+	for rows.Next() {
+		t, err := scanShadowTarget(rows)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+func scanShadowTarget(row pgx.Row) (replay.ShadowTarget, error) {
+	var (
+		t                                   replay.ShadowTarget
+		id, projectID, sourceID, destID     uuid.UUID
+		targetURL                           *string
+		policy, baselines, retry, schedules []byte
+	)
+	if err := row.Scan(&id, &projectID, &sourceID, &destID, &t.Status, &t.ReplayStrategy, &t.DiffStrategy, &targetURL,
+		&policy, &baselines, &retry, &schedules); err != nil {
+		return replay.ShadowTarget{}, err
+	}
+	t.ID = id.String()
+	t.ProjectID = projectID.String()
+	t.SourceEnvironmentID = sourceID.String()
+	t.TargetEnvironmentID = destID.String()
+	t.TargetURL = derefString(targetURL)
+	if len(policy) > 0 && string(policy) != "null" {
+		if err := json.Unmarshal(policy, &t.Policy); err != nil {
+			return replay.ShadowTarget{}, fmt.Errorf("shadow target %s replay policy: %w", id, err)
+		}
+	}
+	if len(baselines) > 0 && string(baselines) != "null" {
+		if err := json.Unmarshal(baselines, &t.BaselineURLs); err != nil {
+			return replay.ShadowTarget{}, fmt.Errorf("shadow target %s baseline urls: %w", id, err)
+		}
+	}
+	if len(retry) > 0 && string(retry) != "null" {
+		if err := json.Unmarshal(retry, &t.Retry); err != nil {
+			return replay.ShadowTarget{}, fmt.Errorf("shadow target %s retry policy: %w", id, err)
+		}
+	}
+	if len(schedules) > 0 && string(schedules) != "null" {
+		if err := json.Unmarshal(schedules, &t.Schedules); err != nil {
+			return replay.ShadowTarget{}, fmt.Errorf("shadow target %s schedules: %w", id, err)
+		}
+	}
+	return t, nil
+}
+
+func (r *ReplayRepository) SelectSessions(ctx context.Context, environmentID string, p replay.JobParams) ([]traffic.SessionID, error) {
+	envID, err := parseUUID("environment id", environmentID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, 0, len(p.SessionIDs))
+	for _, sid := range p.SessionIDs {
+		id, err := parseUUID("session id", string(sid))
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	limit := int64(math.MaxInt32)
+	if p.Limit > 0 {
+		limit = int64(p.Limit)
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT id
+		FROM traffic_sessions
+		WHERE source_environment_id = $1
+		  AND deleted_at IS NULL
+		  AND (cardinality($2::uuid[]) = 0 OR id = ANY($2))
+		  AND ($3::timestamptz IS NULL OR started_at >= $3)
+		  AND ($4::timestamptz IS NULL OR started_at < $4)
+		ORDER BY started_at, id
+		LIMIT $5
+	`, envID, ids, p.From, p.To, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []traffic.SessionID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, traffic.SessionID(id.String()))
+	}
+	return out, rows.Err()
+}
+
+// taskMetadata is stored in replay_tasks.metadata.
+type taskMetadata struct {
+	SessionIDs []traffic.SessionID `json:"session_ids,omitempty"`
+}
+
+func (r *ReplayRepository) PlanQueuedJob(ctx context.Context, plan func(replay.ReplayJob) ([]replay.Task, error)) (replay.ReplayJob, bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return replay.ReplayJob{}, false, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	job, err := scanReplayJob(tx.QueryRow(ctx, `
+		SELECT `+replayJobColumns+`
+		FROM replay_jobs
+		WHERE status = 'queued'
+		ORDER BY requested_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return replay.ReplayJob{}, false, nil
+		}
+		return replay.ReplayJob{}, false, err
+	}
+	jobID := uuid.MustParse(string(job.ID))
+
+	now := time.Now().UTC()
+	tasks, planErr := plan(job)
+	if planErr != nil {
+		job.Status = replay.StatusFailed
+		job.ErrorMessage = planErr.Error()
+		job.FinishedAt = &now
+		if _, err := tx.Exec(ctx, `
+			UPDATE replay_jobs SET status = 'failed', error_message = $2, finished_at = $3, updated_at = now()
+			WHERE id = $1
+		`, jobID, job.ErrorMessage, now); err != nil {
+			return replay.ReplayJob{}, false, err
+		}
+		return job, true, tx.Commit(ctx)
+	}
+
+	rows := make([][]any, 0, len(tasks))
+	for _, t := range tasks {
+		row, err := replayTaskRow(jobID, t)
+		if err != nil {
+			return replay.ReplayJob{}, false, err
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) > 0 {
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"replay_tasks"},
+			[]string{"id", "replay_job_id", "task_type", "traffic_session_id", "batch_key", "status", "attempt", "metadata"},
+			pgx.CopyFromRows(rows)); err != nil {
+			return replay.ReplayJob{}, false, fmt.Errorf("copy replay_tasks: %w", err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE replay_jobs SET status = 'running', started_at = $2, updated_at = now()
+		WHERE id = $1
+	`, jobID, now); err != nil {
+		return replay.ReplayJob{}, false, err
+	}
+	job.Status = replay.StatusRunning
+	job.StartedAt = &now
+	return job, true, tx.Commit(ctx)
+}
+
+func replayTaskRow(jobID uuid.UUID, t replay.Task) ([]any, error) {
+	id, err := parseUUID("replay task id", string(t.ID))
+	if err != nil {
+		return nil, err
+	}
+	var sessionID *uuid.UUID
+	if t.Type == replay.TaskSession && len(t.SessionIDs) == 1 {
+		sid, err := parseUUID("session id", string(t.SessionIDs[0]))
+		if err != nil {
+			return nil, err
+		}
+		sessionID = &sid
+	}
+	metadata, err := json.Marshal(taskMetadata{SessionIDs: t.SessionIDs})
+	if err != nil {
+		return nil, err
+	}
+	status := t.Status
+	if status == "" {
+		status = replay.StatusQueued
+	}
+	return []any{id, jobID, string(t.Type), sessionID, nullString(t.BatchKey), string(status), int32(t.Attempt), metadata}, nil
+}
+
+// ClaimTask relies on FOR UPDATE SKIP LOCKED so that workers polling at the
+// same time each get a different task.
+func (r *ReplayRepository) ClaimTask(ctx context.Context, owner string, lease time.Duration) (replay.Task, bool, error) {
+	var (
+		t         replay.Task
+		id, jobID uuid.UUID
+		taskType  string
+		sessionID *uuid.UUID
+		batchKey  *string
+		attempt   int32
+		metadata  []byte
+	)
+	err := r.pool.QueryRow(ctx, `
+		UPDATE replay_tasks
+		SET status = 'running', attempt = attempt + 1,
+		    lease_owner = $1, lease_expires_at = now() + make_interval(secs => $2),
+		    started_at = now(), finished_at = NULL, updated_at = now()
+		WHERE id = (
+			SELECT t.id
+			FROM replay_tasks t
+			JOIN replay_jobs j ON j.id = t.replay_job_id
+			WHERE t.status = 'queued'
+			  AND j.status = 'running'
+			  AND (t.scheduled_at IS NULL OR t.scheduled_at <= now())
+			ORDER BY j.started_at, t.created_at, t.id
+			LIMIT 1
+			FOR UPDATE OF t SKIP LOCKED
+		)
+		RETURNING id, replay_job_id, task_type, traffic_session_id, batch_key, attempt, lease_expires_at, started_at, metadata
+	`, owner, lease.Seconds()).Scan(&id, &jobID, &taskType, &sessionID, &batchKey, &attempt, &t.LeaseExpiresAt, &t.StartedAt, &metadata)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return replay.Task{}, false, nil
+		}
+		return replay.Task{}, false, err
+	}
+
+	t.ID = replay.TaskID(id.String())
+	t.JobID = replay.ReplayID(jobID.String())
+	t.Type = replay.TaskType(taskType)
+	t.BatchKey = derefString(batchKey)
+	t.Status = replay.StatusRunning
+	t.Attempt = int(attempt)
+	t.LeaseOwner = owner
+	if len(metadata) > 0 {
+		var meta taskMetadata
+		if err := json.Unmarshal(metadata, &meta); err != nil {
+			return replay.Task{}, false, fmt.Errorf("replay task %s metadata: %w", id, err)
+		}
+		t.SessionIDs = meta.SessionIDs
+	}
+	if len(t.SessionIDs) == 0 && sessionID != nil {
+		t.SessionIDs = []traffic.SessionID{traffic.SessionID(sessionID.String())}
+	}
+	return t, true, nil
+}
+
+// RenewLease also returns the status of the task's job, so the worker
+// notices when the job is paused or canceled.
+func (r *ReplayRepository) RenewLease(ctx context.Context, id replay.TaskID, owner string, lease time.Duration) (replay.Status, error) {
+	taskID, err := parseUUID("replay task id", string(id))
+	if err != nil {
+		return "", err
+	}
+	var jobStatus string
+	err = r.pool.QueryRow(ctx, `
+		UPDATE replay_tasks t
+		SET lease_expires_at = now() + make_interval(secs => $3), updated_at = now()
+		FROM replay_jobs j
+		WHERE t.id = $1 AND t.lease_owner = $2 AND t.status = 'running' AND j.id = t.replay_job_id
+		RETURNING j.status
+	`, taskID, owner, lease.Seconds()).Scan(&jobStatus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", replay.ErrLeaseLost
+		}
+		return "", err
+	}
+	return replay.Status(jobStatus), nil
+}
+
+// RequeueExpired handles tasks left running by a worker that crashed or
+// lost its connection. The attempt count was raised when the task was
+// claimed, so it already includes the lost attempt, which is recorded as
+// failed. The limit on attempts is the shadow target's, as for retries
+// after errors, and maxAttempts for targets that set none. Tasks of
+// canceled jobs are canceled instead.
+func (r *ReplayRepository) RequeueExpired(ctx context.Context, maxAttempts int) ([]replay.ExpiredTask, error) {
+	rows, err := r.pool.Query(ctx, `
+		WITH expired AS (
+			SELECT t.id, t.lease_owner AS owner, j.status = 'canceled' AS canceled,
+			       COALESCE(CASE WHEN jsonb_typeof(st.config -> 'retry_policy' -> 'max_attempts') = 'number' THEN
+			           NULLIF(GREATEST((st.config -> 'retry_policy' ->> 'max_attempts')::numeric::int, 0), 0)
+			       END, $1::int) AS max_attempts,
+			       'lease of worker ' || COALESCE(t.lease_owner, 'unknown') || ' expired on attempt ' || t.attempt AS message
+			FROM replay_tasks t
+			JOIN replay_jobs j ON j.id = t.replay_job_id
+			JOIN shadow_targets st ON st.id = j.shadow_target_id
+			WHERE t.status = 'running'
+			  AND (t.lease_expires_at IS NULL OR t.lease_expires_at < now())
+			FOR UPDATE OF t SKIP LOCKED
+		), requeued AS (
+			UPDATE replay_tasks t
+			SET status = CASE
+			        WHEN expired.canceled THEN 'canceled'
+			        WHEN t.attempt >= expired.max_attempts THEN 'failed'
+			        ELSE 'queued'
+			    END,
+			    error_message = expired.message,
+			    finished_at = CASE WHEN expired.canceled OR t.attempt >= expired.max_attempts THEN now() END,
+			    lease_owner = NULL,
+			    lease_expires_at = NULL,
+			    updated_at = now()
+			FROM expired
+			WHERE t.id = expired.id
+			RETURNING t.id, t.replay_job_id, t.status, t.attempt, t.started_at, expired.owner, expired.message
+		), recorded AS (
+			INSERT INTO replay_task_attempts (replay_task_id, attempt, status, worker, error_message, started_at, finished_at)
+			SELECT id, attempt, 'failed', owner, message, started_at, now()
+			FROM requeued
+			ON CONFLICT DO NOTHING
+		)
+		SELECT id, replay_job_id, status FROM requeued
+	`, int32(maxAttempts))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []replay.ExpiredTask
+	for rows.Next() {
+		var (
+			id, jobID uuid.UUID
+			status    string
+		)
+		if err := rows.Scan(&id, &jobID, &status); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, replay.ExpiredTask{
+			ID:     replay.TaskID(id.String()),
+			JobID:  replay.ReplayID(jobID.String()),
+			Status: replay.Status(status),
+		})
+	}
+	return tasks, rows.Err()
+}
+
+// FinishTask only touches the task while t.LeaseOwner holds it, so a worker
+// whose lease expired cannot overwrite the outcome of the next attempt. A
+// task queued again on shutdown or pause gets its attempt back; one queued
+// with a ScheduledAt is a retry, and its attempt is recorded as failed.
+// Every other outcome is recorded as the attempt's.
+func (r *ReplayRepository) FinishTask(ctx context.Context, t replay.Task) error {
+	id, err := parseUUID("replay task id", string(t.ID))
+	if err != nil {
+		return err
+	}
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var (
+		attempt   int32
+		startedAt *time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		UPDATE replay_tasks
+		SET status = $3, error_message = $4,
+		    finished_at = CASE WHEN $3 = 'queued' THEN NULL ELSE $5 END,
+		    scheduled_at = CASE WHEN $3 = 'queued' THEN $6 ELSE scheduled_at END,
+		    attempt = CASE WHEN $3 = 'queued' AND $6::timestamptz IS NULL THEN GREATEST(attempt - 1, 0) ELSE attempt END,
+		    lease_owner = CASE WHEN $3 = 'queued' THEN NULL ELSE lease_owner END,
+		    lease_expires_at = NULL,
+		    updated_at = now()
+		WHERE id = $1 AND lease_owner = $2 AND status = 'running'
+		RETURNING attempt, started_at
+	`, id, t.LeaseOwner, string(t.Status), nullString(t.ErrorMessage), t.FinishedAt, t.ScheduledAt).Scan(&attempt, &startedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return replay.ErrLeaseLost
+		}
+		return err
+	}
+
+	if t.Status != replay.StatusQueued || t.ScheduledAt != nil {
+		status := t.Status
+		if status == replay.StatusQueued {
+			status = replay.StatusFailed
+		}
+		finishedAt := time.Now().UTC()
+		if t.FinishedAt != nil {
+			finishedAt = *t.FinishedAt
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO replay_task_attempts (replay_task_id, attempt, status, worker, error_message, started_at, finished_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT DO NOTHING
+		`, id, attempt, string(status), nullString(t.LeaseOwner), nullString(t.ErrorMessage), startedAt, finishedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// ListAttempts returns the recorded attempts of a job's tasks, oldest
+// first.
+func (r *ReplayRepository) ListAttempts(ctx context.Context, id replay.ReplayID) ([]replay.TaskAttempt, error) {
+	jobID, err := parseUUID("replay job id", string(id))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT a.replay_task_id, a.attempt, a.status, a.worker, a.error_message, a.started_at, a.finished_at
+		FROM replay_task_attempts a
+		JOIN replay_tasks t ON t.id = a.replay_task_id
+		WHERE t.replay_job_id = $1
+		ORDER BY a.finished_at, a.replay_task_id, a.attempt
+	`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []replay.TaskAttempt
+	for rows.Next() {
+		var (
+			a              replay.TaskAttempt
+			taskID         uuid.UUID
+			attempt        int32
+			status         string
+			worker, errMsg *string
+		)
+		if err := rows.Scan(&taskID, &attempt, &status, &worker, &errMsg, &a.StartedAt, &a.FinishedAt); err != nil {
+			return nil, err
+		}
+		a.TaskID = replay.TaskID(taskID.String())
+		a.Attempt = int(attempt)
+		a.Status = replay.Status(status)
+		a.Worker = derefString(worker)
+		a.ErrorMessage = derefString(errMsg)
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// FinishJob fails a job if any of its tasks failed and succeeds it
+// otherwise.
+func (r *ReplayRepository) FinishJob(ctx context.Context, id replay.ReplayID) (replay.Status, bool, error) {
+	jobID, err := parseUUID("replay job id", string(id))
+	if err != nil {
+		return "", false, err
+	}
+	var status string
+	err = r.pool.QueryRow(ctx, `
+		WITH failed AS (
+			SELECT COUNT(*) AS n FROM replay_tasks WHERE replay_job_id = $1 AND status = 'failed'
+		)
+		UPDATE replay_jobs
+		SET status = CASE WHEN failed.n > 0 THEN 'failed' ELSE 'succeeded' END,
+		    error_message = CASE WHEN failed.n > 0 THEN failed.n || ' task(s) failed' END,
+		    finished_at = now(),
+		    updated_at = now()
+		FROM failed
+		WHERE id = $1
+		  AND status = 'running'
+		  AND NOT EXISTS (
+			SELECT 1 FROM replay_tasks WHERE replay_job_id = $1 AND status IN ('queued', 'running')
+		  )
+		RETURNING status
+	`, jobID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return replay.Status(status), true, nil
+}
+
+// PauseJob stops a queued or running job from handing out tasks. Workers
+// put its running tasks back in the queue.
+func (r *ReplayRepository) PauseJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error) {
+	return r.transitionJob(ctx, id, `
+		UPDATE replay_jobs SET status = 'paused', updated_at = now()
+		WHERE id = $1 AND status IN ('queued', 'running')
+		RETURNING `+replayJobColumns)
+}
+
+// ResumeJob lets a paused job continue with its unfinished tasks, or be
+// planned if it never started.
+func (r *ReplayRepository) ResumeJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error) {
+	return r.transitionJob(ctx, id, `
+		UPDATE replay_jobs
+		SET status = CASE WHEN started_at IS NULL THEN 'queued' ELSE 'running' END, updated_at = now()
+		WHERE id = $1 AND status = 'paused'
+		RETURNING `+replayJobColumns)
+}
+
+// CancelJob ends a job that has not finished and cancels its queued tasks.
+// Workers cancel its running tasks.
+func (r *ReplayRepository) CancelJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error) {
+	jobID, err := parseUUID("replay job id", string(id))
+	if err != nil {
+		return replay.ReplayJob{}, err
+	}
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return replay.ReplayJob{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	job, err := scanReplayJob(tx.QueryRow(ctx, `
+		UPDATE replay_jobs SET status = 'canceled', finished_at = now(), updated_at = now()
+		WHERE id = $1 AND status IN ('queued', 'running', 'paused')
+		RETURNING `+replayJobColumns, jobID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return replay.ReplayJob{}, r.transitionError(ctx, id, jobID)
+		}
+		return replay.ReplayJob{}, err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE replay_tasks SET status = 'canceled', finished_at = now(), updated_at = now()
+		WHERE replay_job_id = $1 AND status = 'queued'
+	`, jobID); err != nil {
+		return replay.ReplayJob{}, err
+	}
+	return job, tx.Commit(ctx)
+}
+
+func (r *ReplayRepository) transitionJob(ctx context.Context, id replay.ReplayID, query string) (replay.ReplayJob, error) {
+	jobID, err := parseUUID("replay job id", string(id))
+	if err != nil {
+		return replay.ReplayJob{}, err
+	}
+	job, err := scanReplayJob(r.pool.QueryRow(ctx, query, jobID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return replay.ReplayJob{}, r.transitionError(ctx, id, jobID)
+		}
+		return replay.ReplayJob{}, err
+	}
+	return job, nil
+}
+
+// transitionError explains why a job's status could not change: it does
+// not exist or its status does not allow it.
+func (r *ReplayRepository) transitionError(ctx context.Context, id replay.ReplayID, jobID uuid.UUID) error {
+	var status string
+	err := r.pool.QueryRow(ctx, `SELECT status FROM replay_jobs WHERE id = $1`, jobID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("replay job %s: %w", id, common.ErrNotFound)
+		}
+		return err
+	}
+	return fmt.Errorf("%w: replay job %s is %s", common.ErrConflict, id, status)
+}
+
+// ListTaskResults returns the last result of each request the task has
+// replayed so far, over all its attempts.
+func (r *ReplayRepository) ListTaskResults(ctx context.Context, id replay.TaskID) ([]replay.Result, error) {
+	taskID, err := parseUUID("replay task id", string(id))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT DISTINCT ON (traffic_request_id) id, traffic_request_id, attempt, status, target_status_code, error_class, error_message
+		FROM replay_results
+		WHERE replay_task_id = $1 AND traffic_request_id IS NOT NULL
+		ORDER BY traffic_request_id, attempt DESC, finished_at DESC
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []replay.Result
+	for rows.Next() {
+		var (
+			res                      replay.Result
+			resID, requestID         uuid.UUID
+			attempt                  int32
+			status                   string
+			statusCode               *int32
+			errorClass, errorMessage *string
+		)
+		if err := rows.Scan(&resID, &requestID, &attempt, &status, &statusCode, &errorClass, &errorMessage); err != nil {
+			return nil, err
+		}
+		res.ID = replay.ResultID(resID.String())
+		res.TaskID = id
+		res.TrafficRequestID = traffic.CaptureID(requestID.String())
+		res.Attempt = int(attempt)
+		res.Status = replay.ResultStatus(status)
+		if statusCode != nil {
+			res.StatusCode = int(*statusCode)
+		}
+		res.ErrorClass = derefString(errorClass)
+		res.ErrorMessage = derefString(errorMessage)
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+func (r *ReplayRepository) SaveResult(ctx context.Context, res replay.Result) error {
+	id, err := parseUUID("replay result id", string(res.ID))
+	if err != nil {
+		return err
+	}
+	taskID, err := parseUUID("replay task id", string(res.TaskID))
+	if err != nil {
+		return err
+	}
+	var requestID *uuid.UUID
+	if res.TrafficRequestID != "" {
+		rid, err := parseUUID("traffic request id", string(res.TrafficRequestID))
+		if err != nil {
+			return err
+		}
+		requestID = &rid
+	}
+	var statusCode, latencyMS, size *int32
+	if res.StatusCode > 0 {
+		n := int32(res.StatusCode)
+		statusCode = &n
+		l := int32(min(res.Latency.Milliseconds(), math.MaxInt32))
+		latencyMS = &l
+		s := int32(min(res.ResponseSize, math.MaxInt32))
+		size = &s
+	}
+	finishedAt := res.FinishedAt
+	if finishedAt.IsZero() {
+		finishedAt = time.Now().UTC()
+	}
+
+	_, err = r.pool.Exec(ctx, `
+		INSERT INTO replay_results (id, replay_task_id, traffic_request_id, status, target_status_code, latency_ms,
+			response_size_bytes, response_hash, error_class, error_message, finished_at, attempt)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`, id, taskID, requestID, string(res.Status), statusCode, latencyMS, size,
+		nullString(res.ResponseHash), nullString(res.ErrorClass), nullString(res.ErrorMessage), finishedAt, int32(max(res.Attempt, 1)))
+	return err
+}
@@ -0,0 +1,581 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"synthema/internal/domain/common"
+	"synthema/internal/domain/traffic"
+	"synthema/internal/ports/repository"
+)
+
+var trafficRequestColumns = []string{
+	"id",
+	"session_id",
+	"sequence_no",
+	"captured_at",
+	"method",
+	"scheme",
+	"host",
+	"path",
+	"query_string",
+	"headers",
+	"content_length_bytes",
+	"body_hash",
+	"request_fingerprint",
+	"client_ip_hash",
+	"metadata",
+}
+
+// TrafficRepository persists captured traffic into traffic_sessions and
+// traffic_requests. Batches are written with COPY inside one transaction.
+type TrafficRepository struct {
+	pool *pgxpool.Pool
+}
+
+var _ repository.TrafficRepository = (*TrafficRepository)(nil)
+
+func NewTrafficRepository(pool *pgxpool.Pool) *TrafficRepository {
+	return &TrafficRepository{pool: pool}
+}
+
+func (r *TrafficRepository) SaveCapturedTraffic(ctx context.Context, t traffic.CapturedTraffic) error {
+	return r.SaveCapturedTrafficBatch(ctx, []traffic.CapturedTraffic{t})
+}
+
+// SaveCapturedTrafficBatch upserts the sessions referenced by the batch and
+// adds the requests to them. Sequence numbers follow capture order within a
+// session: a request that arrives after later-captured ones is slotted in
+// before them and they are renumbered. Records whose ID is already stored
+// are skipped, so redelivered batches are harmless.
+func (r *TrafficRepository) SaveCapturedTrafficBatch(ctx context.Context, batch []traffic.CapturedTraffic) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	sessions := make(map[uuid.UUID][]traffic.CapturedTraffic)
+	requestIDs := make([]uuid.UUID, 0, len(batch))
+	for _, t := range batch {
+		sessionID, err := parseUUID("session id", string(t.SessionID))
+		if err != nil {
+			return err
+		}
+		id, err := parseUUID("capture id", string(t.ID))
+		if err != nil {
+			return err
+		}
+		sessions[sessionID] = append(sessions[sessionID], t)
+		requestIDs = append(requestIDs, id)
+	}
+
+	// Lock sessions in a stable order so concurrent batches touching the same
+	// sessions cannot deadlock.
+	sessionIDs := make([]uuid.UUID, 0, len(sessions))
+	for id := range sessions {
+		sessionIDs = append(sessionIDs, id)
+	}
+	sort.Slice(sessionIDs, func(i, j int) bool {
+		return sessionIDs[i].String() < sessionIDs[j].String()
+	})
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	existing, err := existingRequestIDs(ctx, tx, requestIDs)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]any, 0, len(batch))
+	for _, sessionID := range sessionIDs {
+		records := sessions[sessionID]
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].CapturedAt.Before(records[j].CapturedAt)
+		})
+
+		if err := upsertSession(ctx, tx, sessionID, records); err != nil {
+			return err
+		}
+
+		var added []traffic.CapturedTraffic
+		for _, t := range records {
+			id := uuid.MustParse(string(t.ID))
+			if _, ok := existing[id]; ok {
+				continue
+			}
+			existing[id] = struct{}{}
+			added = append(added, t)
+		}
+		if len(added) == 0 {
+			continue
+		}
+		seqs, err := sequenceRequests(ctx, tx, sessionID, added)
+		if err != nil {
+			return err
+		}
+		for i, t := range added {
+			row, err := trafficRequestRow(uuid.MustParse(string(t.ID)), sessionID, seqs[i], t)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if len(rows) > 0 {
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"traffic_requests"}, trafficRequestColumns, pgx.CopyFromRows(rows)); err != nil {
+			return fmt.Errorf("copy traffic_requests: %w", err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// sequenceRequests numbers the requests added to a session, which are in
+// capture order, and renumbers the stored requests captured after the first
+// of them so the session's sequence numbers keep following capture order.
+// Stored requests go first among those captured at the same time. It runs
+// under the session's row lock; see upsertSession.
+func sequenceRequests(ctx context.Context, tx pgx.Tx, sessionID uuid.UUID, added []traffic.CapturedTraffic) ([]int, error) {
+	earliest := added[0].CapturedAt
+	var base int
+	if err := tx.QueryRow(ctx, `
+		SELECT COALESCE(MAX(sequence_no), -1)
+		FROM traffic_requests
+		WHERE session_id = $1 AND captured_at <= $2
+	`, sessionID, earliest).Scan(&base); err != nil {
+		return nil, err
+	}
+
+	type stored struct {
+		id         uuid.UUID
+		capturedAt time.Time
+		seq        int
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT id, captured_at, sequence_no
+		FROM traffic_requests
+		WHERE session_id = $1 AND captured_at > $2
+		ORDER BY captured_at, sequence_no
+	`, sessionID, earliest)
+	if err != nil {
+		return nil, err
+	}
+	var later []stored
+	for rows.Next() {
+		var s stored
+		if err := rows.Scan(&s.id, &s.capturedAt, &s.seq); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		later = append(later, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Merge both runs by capture time. Postgres keeps microseconds, so
+	// the added requests are compared at that precision.
+	seqs := make([]int, len(added))
+	var ids []uuid.UUID
+	var moved []int32
+	next := base + 1
+	i, j := 0, 0
+	for i < len(added) || j < len(later) {
+		if j < len(later) && (i == len(added) || !later[j].capturedAt.After(added[i].CapturedAt.Truncate(time.Microsecond))) {
+			if later[j].seq != next {
+				ids = append(ids, later[j].id)
+				moved = append(moved, int32(next))
+			}
+			j++
+		} else {
+			seqs[i] = next
+			i++
+		}
+		next++
+	}
+	if len(ids) == 0 {
+		return seqs, nil
+	}
+
+	// Shifting numbers passes through values other rows still hold, so
+	// uniqueness is checked at commit.
+	if _, err := tx.Exec(ctx, `SET CONSTRAINTS traffic_requests_session_sequence_unique DEFERRED`); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE traffic_requests t
+		SET sequence_no = m.sequence_no
+		FROM unnest($1::uuid[], $2::int[]) AS m(id, sequence_no)
+		WHERE t.id = m.id
+	`, ids, moved); err != nil {
+		return nil, err
+	}
+	return seqs, nil
+}
+
+func existingRequestIDs(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) (map[uuid.UUID]struct{}, error) {
+	rows, err := tx.Query(ctx, `SELECT id FROM traffic_requests WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[uuid.UUID]struct{})
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		existing[id] = struct{}{}
+	}
+	return existing, rows.Err()
+}
+
+// upsertSession creates the session on first sight and widens started_at
+// otherwise. A session closed by the idle reaper is reopened when late
+// traffic for it arrives. The upsert also row-locks the session until
+// commit, which serialises sequence number assignment per session.
+func upsertSession(ctx context.Context, tx pgx.Tx, sessionID uuid.UUID, records []traffic.CapturedTraffic) error {
+	first := records[0]
+	projectID, err := parseUUID("project id", first.ProjectID)
+	if err != nil {
+		return err
+	}
+	environmentID, err := parseUUID("environment id", first.EnvironmentID)
+	if err != nil {
+		return err
+	}
+	var shadowTargetID *uuid.UUID
+	if first.ShadowTargetID != "" {
+		id, err := parseUUID("shadow target id", first.ShadowTargetID)
+		if err != nil {
+			return err
+		}
+		shadowTargetID = &id
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO traffic_sessions (id, project_id, source_environment_id, shadow_target_id, external_session_key, status, started_at)
+		VALUES ($1, $2, $3, $4, $5, 'open', $6)
+		ON CONFLICT (id) DO UPDATE
+		SET started_at = LEAST(traffic_sessions.started_at, EXCLUDED.started_at),
+		    status = CASE WHEN traffic_sessions.status = 'closed' THEN 'open' ELSE traffic_sessions.status END,
+		    ended_at = CASE WHEN traffic_sessions.status = 'closed' THEN NULL ELSE traffic_sessions.ended_at END,
+		    updated_at = now()
+	`, sessionID, projectID, environmentID, shadowTargetID, nullString(first.ExternalSessionKey), first.CapturedAt)
+	return err
+}
+
+// CloseIdleSessions closes open sessions whose latest request was captured
+// before idleSince. ended_at is set to that latest capture time.
+func (r *TrafficRepository) CloseIdleSessions(ctx context.Context, idleSince time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE traffic_sessions s
+		SET status = 'closed',
+		    ended_at = last.captured_at,
+		    updated_at = now()
+		FROM (
+			SELECT r.session_id, MAX(r.captured_at) AS captured_at
+			FROM traffic_requests r
+			JOIN traffic_sessions os ON os.id = r.session_id AND os.status = 'open'
+			GROUP BY r.session_id
+		) last
+		WHERE s.id = last.session_id
+		  AND s.status = 'open'
+		  AND last.captured_at < $1
+	`, idleSince)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *TrafficRepository) GetSession(ctx context.Context, id traffic.SessionID) (traffic.Session, error) {
+	sessionID, err := parseUUID("session id", string(id))
+	if err != nil {
+		return traffic.Session{}, err
+	}
+
+	var (
+		sess           traffic.Session
+		projectID      uuid.UUID
+		environmentID  uuid.UUID
+		shadowTargetID *uuid.UUID
+		externalKey    *string
+		startedAt      *time.Time
+	)
+	err = r.pool.QueryRow(ctx, `
+		SELECT project_id, source_environment_id, shadow_target_id, external_session_key, status, started_at, ended_at
+		FROM traffic_sessions
+		WHERE id = $1 AND deleted_at IS NULL
+	`, sessionID).Scan(&projectID, &environmentID, &shadowTargetID, &externalKey, &sess.Status, &startedAt, &sess.EndedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return traffic.Session{}, fmt.Errorf("traffic session %s: %w", id, common.ErrNotFound)
+		}
+		return traffic.Session{}, err
+	}
+
+	sess.ID = id
+	sess.ProjectID = projectID.String()
+	sess.EnvironmentID = environmentID.String()
+	if shadowTargetID != nil {
+		sess.ShadowTargetID = shadowTargetID.String()
+	}
+	if externalKey != nil {
+		sess.ExternalSessionKey = *externalKey
+	}
+	if startedAt != nil {
+		sess.StartedAt = *startedAt
+	}
+	return sess, nil
+}
+
+func (r *TrafficRepository) ListSessionRequests(ctx context.Context, id traffic.SessionID) ([]traffic.CapturedTraffic, error) {
+	sessionID, err := parseUUID("session id", string(id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, sequence_no, captured_at, method, scheme, host, path, query_string, headers,
+		       content_length_bytes, body_hash, request_fingerprint, client_ip_hash, metadata
+		FROM traffic_requests
+		WHERE session_id = $1
+		ORDER BY sequence_no
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []traffic.CapturedTraffic
+	for rows.Next() {
+		var (
+			reqID             uuid.UUID
+			seq               int32
+			capturedAt        time.Time
+			method, path      string
+			scheme, host      *string
+			query, bodyHash   *string
+			fingerprint       *string
+			clientIPHash      *string
+			headers, metadata []byte
+			contentLength     *int32
+		)
+		if err := rows.Scan(&reqID, &seq, &capturedAt, &method, &scheme, &host, &path, &query, &headers,
+			&contentLength, &bodyHash, &fingerprint, &clientIPHash, &metadata); err != nil {
+			return nil, err
+		}
+
+		t := traffic.CapturedTraffic{
+			ID:           traffic.CaptureID(reqID.String()),
+			CapturedAt:   capturedAt,
+			SessionID:    id,
+			SequenceNo:   int(seq),
+			Method:       method,
+			Fingerprint:  derefString(fingerprint),
+			ClientIPHash: derefString(clientIPHash),
+			Request: traffic.Request{
+				Scheme:      derefString(scheme),
+				Host:        derefString(host),
+				Path:        path,
+				QueryString: derefString(query),
+			},
+		}
+		if len(headers) > 0 {
+			if err := json.Unmarshal(headers, &t.Request.Headers); err != nil {
+				return nil, fmt.Errorf("traffic request %s headers: %w", reqID, err)
+			}
+		}
+		if len(metadata) > 0 {
+			var meta requestMetadata
+			if err := json.Unmarshal(metadata, &meta); err != nil {
+				return nil, fmt.Errorf("traffic request %s metadata: %w", reqID, err)
+			}
+			t.URL = meta.URL
+			t.Protocol = meta.Protocol
+			if meta.GRPC != nil {
+				t.GRPC = &traffic.GRPCCall{Service: meta.GRPC.Service, Method: meta.GRPC.Method}
+			}
+			t.Latency = time.Duration(meta.LatencyMS) * time.Millisecond
+			t.Request.Body = meta.RequestBody.body()
+			t.Response = traffic.Response{
+				StatusCode: meta.Response.StatusCode,
+				Headers:    meta.Response.Headers,
+				Trailers:   meta.Response.Trailers,
+				Body:       meta.Response.Body.body(),
+			}
+			for _, f := range meta.Frames {
+				t.Frames = append(t.Frames, traffic.Frame{
+					Offset:    time.Duration(f.OffsetMS) * time.Millisecond,
+					Direction: f.Direction,
+					Opcode:    f.Opcode,
+					Body:      f.Body.body(),
+				})
+			}
+		}
+		if t.Request.Body.Empty() && contentLength != nil {
+			t.Request.Body = traffic.Body{Hash: derefString(bodyHash), Size: int64(*contentLength)}
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+type requestMetadata struct {
+	URL         string           `json:"url,omitempty"`
+	Protocol    traffic.Protocol `json:"protocol,omitempty"`
+	GRPC        *grpcMetadata    `json:"grpc,omitempty"`
+	LatencyMS   int64            `json:"latency_ms"`
+	RequestBody *bodyMetadata    `json:"request_body,omitempty"`
+	Response    responseMetadata `json:"response"`
+	Frames      []frameMetadata  `json:"frames,omitempty"`
+}
+
+type grpcMetadata struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+type responseMetadata struct {
+	StatusCode int           `json:"status_code"`
+	Headers    http.Header   `json:"headers,omitempty"`
+	Trailers   http.Header   `json:"trailers,omitempty"`
+	Body       *bodyMetadata `json:"body,omitempty"`
+}
+
+type frameMetadata struct {
+	OffsetMS  int64                  `json:"offset_ms"`
+	Direction traffic.FrameDirection `json:"direction"`
+	Opcode    int                    `json:"opcode"`
+	Body      *bodyMetadata          `json:"body,omitempty"`
+}
+
+type bodyMetadata struct {
+	Ref       string `json:"ref,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	Size      int64  `json:"size"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+func trafficRequestRow(id, sessionID uuid.UUID, seq int, t traffic.CapturedTraffic) ([]any, error) {
+	var headers []byte
+	if len(t.Request.Headers) > 0 {
+		b, err := json.Marshal(t.Request.Headers)
+		if err != nil {
+			return nil, err
+		}
+		headers = b
+	}
+
+	meta := requestMetadata{
+		URL:         t.URL,
+		Protocol:    t.Protocol,
+		LatencyMS:   t.Latency.Milliseconds(),
+		RequestBody: newBodyMetadata(t.Request.Body),
+		Response: responseMetadata{
+			StatusCode: t.Response.StatusCode,
+			Headers:    t.Response.Headers,
+			Trailers:   t.Response.Trailers,
+			Body:       newBodyMetadata(t.Response.Body),
+		},
+	}
+	if t.GRPC != nil {
+		meta.GRPC = &grpcMetadata{Service: t.GRPC.Service, Method: t.GRPC.Method}
+	}
+	for _, f := range t.Frames {
+		meta.Frames = append(meta.Frames, frameMetadata{
+			OffsetMS:  f.Offset.Milliseconds(),
+			Direction: f.Direction,
+			Opcode:    f.Opcode,
+			Body:      newBodyMetadata(f.Body),
+		})
+	}
+	metadata, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	var contentLength *int32
+	if t.Request.Body.Size > 0 {
+		n := int32(min(t.Request.Body.Size, math.MaxInt32))
+		contentLength = &n
+	}
+
+	capturedAt := t.CapturedAt
+	if capturedAt.IsZero() {
+		capturedAt = time.Now().UTC()
+	}
+
+	return []any{
+		id,
+		sessionID,
+		int32(seq),
+		capturedAt,
+		t.Method,
+		nullString(t.Request.Scheme),
+		nullString(t.Request.Host),
+		t.Request.Path,
+		nullString(t.Request.QueryString),
+		headers,
+		contentLength,
+		nullString(t.Request.Body.Hash),
+		nullString(t.Fingerprint),
+		nullString(t.ClientIPHash),
+		metadata,
+	}, nil
+}
+
+func newBodyMetadata(b traffic.Body) *bodyMetadata {
+	if b.Empty() {
+		return nil
+	}
+	return &bodyMetadata{Ref: b.Ref, Hash: b.Hash, Size: b.Size, Truncated: b.Truncated}
+}
+
+func (m *bodyMetadata) body() traffic.Body {
+	if m == nil {
+		return traffic.Body{}
+	}
+	return traffic.Body{Ref: m.Ref, Hash: m.Hash, Size: m.Size, Truncated: m.Truncated}
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func parseUUID(field, raw string) (uuid.UUID, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %s %q", common.ErrInvalidInput, field, raw)
+	}
+	return id, nil
+}
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"synthema/internal/domain/common"
+	"synthema/internal/domain/transform"
+	"synthema/internal/ports/repository"
+)
+
+type TransformRepository struct {
+	pool *pgxpool.Pool
+}
+
+var _ repository.TransformRepository = (*TransformRepository)(nil)
+
+func NewTransformRepository(pool *pgxpool.Pool) *TransformRepository {
+	return &TransformRepository{pool: pool}
+}
+
+func (r *TransformRepository) GetRuleSet(ctx context.Context, id transform.RuleSetID) (transform.RuleSet, error) {
+	setID, err := parseUUID("transform rule set id", string(id))
+	if err != nil {
+		return transform.RuleSet{}, err
+	}
+	var (
+		rs        transform.RuleSet
+		projectID uuid.UUID
+		version   int32
+	)
+	err = r.pool.QueryRow(ctx, `
+		SELECT project_id, name, version, status
+		FROM transform_rule_sets
+		WHERE id = $1 AND deleted_at IS NULL
+	`, setID).Scan(&projectID, &rs.Name, &version, &rs.Status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return transform.RuleSet{}, fmt.Errorf("transform rule set %s: %w", id, common.ErrNotFound)
+		}
+		return transform.RuleSet{}, err
+	}
+	rs.ID = id
+	rs.ProjectID = projectID.String()
+	rs.Version = int(version)
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, order_no, match_criteria, action_type, action_config
+		FROM transform_rules
+		WHERE rule_set_id = $1 AND enabled
+		ORDER BY order_no
+	`, setID)
+	if err != nil {
+		return transform.RuleSet{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			rule          transform.Rule
+			ruleID        uuid.UUID
+			orderNo       int32
+			match, config []byte
+		)
+		if err := rows.Scan(&ruleID, &orderNo, &match, &rule.ActionType, &config); err != nil {
+			return transform.RuleSet{}, err
+		}
+		rule.ID = ruleID.String()
+		rule.OrderNo = int(orderNo)
+		if len(match) > 0 {
+			if err := json.Unmarshal(match, &rule.Match); err != nil {
+				return transform.RuleSet{}, fmt.Errorf("transform rule %s match criteria: %w", ruleID, err)
+			}
+		}
+		if rule.ActionType == transform.ActionExtract && len(config) > 0 {
+			rule.Extract = new(transform.Extraction)
+			if err := json.Unmarshal(config, rule.Extract); err != nil {
+				return transform.RuleSet{}, fmt.Errorf("transform rule %s action config: %w", ruleID, err)
+			}
+		}
+		rs.Rules = append(rs.Rules, rule)
+	}
+	return rs, rows.Err()
+}
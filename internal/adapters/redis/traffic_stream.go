@@ -0,0 +1,251 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"synthema/internal/config"
+	"synthema/internal/domain/traffic"
+	"synthema/internal/ports/queue"
+)
+
+const payloadField = "payload"
+
+// TrafficStream buffers captured traffic in a Redis stream. Producers XADD
+// with a bounded MAXLEN; consumers read through a consumer group, reclaim
+// entries left pending by dead consumers and dead-letter entries that keep
+// failing.
+type TrafficStream struct {
+	client *redis.Client
+	cfg    config.TrafficStreamConfig
+
+	mu          sync.Mutex
+	claimCursor string
+}
+
+var (
+	_ queue.TrafficQueue    = (*TrafficStream)(nil)
+	_ queue.TrafficConsumer = (*TrafficStream)(nil)
+)
+
+func NewTrafficStream(client *redis.Client, cfg config.TrafficStreamConfig) (*TrafficStream, error) {
+	if client == nil {
+		return nil, ErrRedisNotConfigured
+	}
+	if cfg.Stream == "" {
+		return nil, errors.New("traffic stream name is required")
+	}
+	return &TrafficStream{client: client, cfg: cfg, claimCursor: "0-0"}, nil
+}
+
+// EnsureGroup creates the stream and the consumer group if they do not
+// exist yet.
+func (s *TrafficStream) EnsureGroup(ctx context.Context) error {
+	err := s.client.XGroupCreateMkStream(ctx, s.cfg.Stream, s.cfg.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+func (s *TrafficStream) EnqueueCapturedTraffic(ctx context.Context, t traffic.CapturedTraffic) error {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.cfg.Stream,
+		MaxLen: s.cfg.MaxLen,
+		Approx: true,
+		Values: map[string]any{payloadField: payload},
+	}).Err()
+}
+
+// ReadCapturedTraffic first reclaims entries that have been pending longer
+// than ClaimMinIdle, then tops up with new entries, blocking up to block.
+func (s *TrafficStream) ReadCapturedTraffic(ctx context.Context, count int, block time.Duration) ([]queue.Delivery, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+
+	deliveries, err := s.reclaim(ctx, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) > 0 {
+		return deliveries, nil
+	}
+
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    s.cfg.Group,
+		Consumer: s.cfg.Consumer,
+		Streams:  []string{s.cfg.Stream, ">"},
+		Count:    int64(count),
+		Block:    block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var poisoned []redis.XMessage
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			d, err := decodeDelivery(msg)
+			if err != nil {
+				poisoned = append(poisoned, msg)
+				continue
+			}
+			deliveries = append(deliveries, d)
+		}
+	}
+	if err := s.deadLetter(ctx, poisoned, "undecodable payload"); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *TrafficStream) AckCapturedTraffic(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.client.XAck(ctx, s.cfg.Stream, s.cfg.Group, ids...).Err()
+}
+
+func (s *TrafficStream) reclaim(ctx context.Context, count int) ([]queue.Delivery, error) {
+	if s.cfg.ClaimMinIdle <= 0 {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	start := s.claimCursor
+	s.mu.Unlock()
+
+	msgs, next, err := s.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   s.cfg.Stream,
+		Group:    s.cfg.Group,
+		MinIdle:  s.cfg.ClaimMinIdle,
+		Start:    start,
+		Count:    int64(count),
+		Consumer: s.cfg.Consumer,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.claimCursor = next
+	s.mu.Unlock()
+
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	retries, err := s.deliveryCounts(ctx, msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]queue.Delivery, 0, len(msgs))
+	var exhausted, poisoned []redis.XMessage
+	for _, msg := range msgs {
+		if s.cfg.MaxDeliveries > 0 && retries[msg.ID] > s.cfg.MaxDeliveries {
+			exhausted = append(exhausted, msg)
+			continue
+		}
+		d, err := decodeDelivery(msg)
+		if err != nil {
+			poisoned = append(poisoned, msg)
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := s.deadLetter(ctx, exhausted, fmt.Sprintf("exceeded %d deliveries", s.cfg.MaxDeliveries)); err != nil {
+		return nil, err
+	}
+	if err := s.deadLetter(ctx, poisoned, "undecodable payload"); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// deliveryCounts looks up how often each claimed entry has been delivered.
+// XAUTOCLAIM itself does not report it. Each entry is queried on its own,
+// pipelined: a range query could be filled up by other pending entries of
+// this consumer between the claimed ones.
+func (s *TrafficStream) deliveryCounts(ctx context.Context, msgs []redis.XMessage) (map[string]int64, error) {
+	cmds := make([]*redis.XPendingExtCmd, len(msgs))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, msg := range msgs {
+			cmds[i] = pipe.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream: s.cfg.Stream,
+				Group:  s.cfg.Group,
+				Start:  msg.ID,
+				End:    msg.ID,
+				Count:  1,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(msgs))
+	for _, cmd := range cmds {
+		for _, p := range cmd.Val() {
+			counts[p.ID] = p.RetryCount
+		}
+	}
+	return counts, nil
+}
+
+// deadLetter moves entries to the dead-letter stream and acknowledges them
+// on the main stream in one transaction.
+func (s *TrafficStream) deadLetter(ctx context.Context, msgs []redis.XMessage, reason string) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		ids := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: s.cfg.DeadLetterStream,
+				MaxLen: s.cfg.MaxLen,
+				Approx: true,
+				Values: map[string]any{
+					payloadField:  msg.Values[payloadField],
+					"original_id": msg.ID,
+					"reason":      reason,
+				},
+			})
+			ids = append(ids, msg.ID)
+		}
+		pipe.XAck(ctx, s.cfg.Stream, s.cfg.Group, ids...)
+		return nil
+	})
+	return err
+}
+
+func decodeDelivery(msg redis.XMessage) (queue.Delivery, error) {
+	raw, ok := msg.Values[payloadField].(string)
+	if !ok {
+		return queue.Delivery{}, fmt.Errorf("stream entry %s has no %s field", msg.ID, payloadField)
+	}
+	var t traffic.CapturedTraffic
+	if err := json.Unmarshal([]byte(raw), &t); err != nil {
+		return queue.Delivery{}, fmt.Errorf("decode stream entry %s: %w", msg.ID, err)
+	}
+	return queue.Delivery{ID: msg.ID, Traffic: t}, nil
+}
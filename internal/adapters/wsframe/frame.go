@@ -0,0 +1,179 @@
+package wsframe
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Opcodes from RFC 6455, section 5.2.
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+var ErrFrameTooLarge = errors.New("websocket frame exceeds the size limit")
+
+type Frame struct {
+	Fin     bool
+	Opcode  byte
+	Payload []byte
+}
+
+// IsControl reports whether the frame is a close, ping or pong frame.
+func (f Frame) IsControl() bool {
+	return f.Opcode&0x8 != 0
+}
+
+// Parser decodes frames from a byte stream that arrives in arbitrary
+// chunks. Masked payloads are unmasked.
+type Parser struct {
+	maxFrame int64
+	buf      bytes.Buffer
+	failed   bool
+}
+
+// NewParser rejects frames with payloads above maxFrame bytes; a zero or
+// negative limit accepts any size.
+func NewParser(maxFrame int64) *Parser {
+	return &Parser{maxFrame: maxFrame}
+}
+
+// Write feeds stream bytes and returns the frames they completed. Once a
+// frame fails to parse the parser stops and keeps returning the error.
+func (p *Parser) Write(b []byte) ([]Frame, error) {
+	if p.failed {
+		return nil, ErrFrameTooLarge
+	}
+	p.buf.Write(b)
+	var frames []Frame
+	for {
+		f, n, err := decode(p.buf.Bytes(), p.maxFrame)
+		if err != nil {
+			p.failed = true
+			p.buf.Reset()
+			return frames, err
+		}
+		if n == 0 {
+			return frames, nil
+		}
+		p.buf.Next(n)
+		frames = append(frames, f)
+	}
+}
+
+// decode parses one frame from b and returns it with the number of bytes it
+// used, or n == 0 if b does not hold a complete frame yet.
+func decode(b []byte, maxFrame int64) (Frame, int, error) {
+	if len(b) < 2 {
+		return Frame{}, 0, nil
+	}
+	f := Frame{Fin: b[0]&0x80 != 0, Opcode: b[0] & 0x0F}
+	masked := b[1]&0x80 != 0
+	length := uint64(b[1] & 0x7F)
+	pos := 2
+	switch length {
+	case 126:
+		if len(b) < pos+2 {
+			return Frame{}, 0, nil
+		}
+		length = uint64(binary.BigEndian.Uint16(b[pos:]))
+		pos += 2
+	case 127:
+		if len(b) < pos+8 {
+			return Frame{}, 0, nil
+		}
+		length = binary.BigEndian.Uint64(b[pos:])
+		pos += 8
+	}
+	if maxFrame > 0 && length > uint64(maxFrame) {
+		return Frame{}, 0, ErrFrameTooLarge
+	}
+	var mask []byte
+	if masked {
+		if len(b) < pos+4 {
+			return Frame{}, 0, nil
+		}
+		mask = b[pos : pos+4]
+		pos += 4
+	}
+	if uint64(len(b)-pos) < length {
+		return Frame{}, 0, nil
+	}
+	f.Payload = bytes.Clone(b[pos : pos+int(length)])
+	for i := range f.Payload {
+		if mask != nil {
+			f.Payload[i] ^= mask[i%4]
+		}
+	}
+	return f, pos + int(length), nil
+}
+
+// Write writes a single unfragmented frame. Clients must mask their frames.
+func Write(w io.Writer, opcode byte, payload []byte, masked bool) error {
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | opcode
+	n := len(payload)
+	switch {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	data := payload
+	if masked {
+		header[1] |= 0x80
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		header = append(header, key[:]...)
+		data = make([]byte, n)
+		for i := range payload {
+			data[i] = payload[i] ^ key[i%4]
+		}
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// Assembler joins fragmented data frames into messages. Control frames,
+// which may be interleaved with fragments, are passed through as is.
+type Assembler struct {
+	opcode  byte
+	partial []byte
+	active  bool
+}
+
+// Add returns a complete message when f finishes one.
+func (a *Assembler) Add(f Frame) (Frame, bool) {
+	if f.IsControl() {
+		return f, true
+	}
+	if f.Opcode != OpContinuation {
+		a.opcode, a.partial, a.active = f.Opcode, nil, true
+	}
+	if !a.active {
+		return Frame{}, false
+	}
+	a.partial = append(a.partial, f.Payload...)
+	if !f.Fin {
+		return Frame{}, false
+	}
+	msg := Frame{Fin: true, Opcode: a.opcode, Payload: a.partial}
+	a.partial, a.active = nil, false
+	return msg, true
+}
@@ -2,24 +2,227 @@ package capture
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"synthema/internal/app/payload"
+	"synthema/internal/app/privacy"
+	"synthema/internal/domain/traffic"
 	"synthema/internal/observability"
+	"synthema/internal/ports/blob"
 	"synthema/internal/ports/queue"
 	"synthema/internal/ports/repository"
 )
 
+const (
+	defaultBufferSize  = 4096
+	defaultConcurrency = 4
+)
+
+var ErrNoSink = errors.New("capture has neither a queue nor a repository configured")
+
 type Service struct {
 	logger *observability.Logger
 
 	repo  repository.TrafficRepository
 	queue queue.TrafficQueue
+
+	opts      ServiceOptions
+	sessions  *Sessionizer
+	dedup     *deduper
+	sanitizer *privacy.Sanitizer
+
+	buffer       chan traffic.CapturedTraffic
+	dropped      atomic.Int64
+	deduplicated atomic.Int64
+}
+
+// ServiceOptions identifies where captured traffic comes from, sizes the
+// hand-off buffer between the proxy and the sink and sets how long a
+// session may stay idle before the next request opens a new one.
+type ServiceOptions struct {
+	ProjectID          string
+	EnvironmentID      string
+	ShadowTargetID     string
+	BufferSize         int
+	SessionIdleTimeout time.Duration
+	// Concurrency is the number of loops moving records from the buffer
+	// to the sink.
+	Concurrency int
+	// Blobs receives request and response bodies before a record is
+	// handed to the sink. Nil keeps bodies inline.
+	Blobs blob.Store
+	// Fingerprinter stamps each record with its request fingerprint.
+	Fingerprinter *traffic.Fingerprinter
+	// DedupWindow drops a request identical to one seen from the same
+	// session key within the window. Zero disables deduplication; it also
+	// requires a Fingerprinter.
+	DedupWindow time.Duration
+	// Hasher pseudonymises client IPs and external session keys. Without
+	// one both are discarded.
+	Hasher *privacy.Hasher
+	// ScrubHeaders are redacted in addition to privacy.DefaultScrubHeaders.
+	ScrubHeaders []string
 }
 
 func NewService(logger *observability.Logger, repo repository.TrafficRepository, q queue.TrafficQueue) *Service {
-	return &Service{logger: logger, repo: repo, queue: q}
+	return NewServiceWithOptions(logger, repo, q, ServiceOptions{})
+}
+
+func NewServiceWithOptions(logger *observability.Logger, repo repository.TrafficRepository, q queue.TrafficQueue, opts ServiceOptions) *Service {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultBufferSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	s := &Service{
+		logger:    logger,
+		repo:      repo,
+		queue:     q,
+		opts:      opts,
+		sessions:  NewSessionizer(opts.SessionIdleTimeout),
+		sanitizer: privacy.NewSanitizer(opts.Hasher, opts.ScrubHeaders),
+		buffer:    make(chan traffic.CapturedTraffic, opts.BufferSize),
+	}
+	if opts.Fingerprinter != nil && opts.DedupWindow > 0 {
+		s.dedup = newDeduper(opts.DedupWindow)
+	}
+	return s
+}
+
+// Capture hands a recorded exchange to the service without blocking the
+// proxied request. When the buffer is full, or the request duplicates a
+// recent one, the record is dropped.
+func (s *Service) Capture(t traffic.CapturedTraffic) bool {
+	if f := s.opts.Fingerprinter; f != nil {
+		t.Fingerprint = f.Fingerprint(t.Method, t.Request.Path, t.Request.QueryString, t.Request.Headers)
+		// A WebSocket connection is a conversation, never a retry.
+		if s.dedup != nil && t.Protocol != traffic.ProtocolWebSocket {
+			key := t.ExternalSessionKey + "\n" + f.DedupKey(t.Method, t.Request.Path, t.Request.QueryString, t.Request.Headers, t.Request.Body.Hash)
+			if s.dedup.duplicate(key, t.CapturedAt) {
+				s.deduplicated.Add(1)
+				return false
+			}
+		}
+	}
+	if t.ProjectID == "" {
+		t.ProjectID = s.opts.ProjectID
+	}
+	if t.EnvironmentID == "" {
+		t.EnvironmentID = s.opts.EnvironmentID
+	}
+	if t.ShadowTargetID == "" {
+		t.ShadowTargetID = s.opts.ShadowTargetID
+	}
+	if t.SessionID == "" {
+		t.SessionID = s.sessions.Assign(t.ExternalSessionKey, t.CapturedAt)
+	}
+	s.sanitizer.Sanitize(&t)
+	select {
+	case s.buffer <- t:
+		return true
+	default:
+		s.dropped.Add(1)
+		return false
+	}
+}
+
+func (s *Service) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *Service) Deduplicated() int64 {
+	return s.deduplicated.Load()
 }
 
 func (s *Service) Run(ctx context.Context) error {
-	<-ctx.Done()
-	return nil
+	if s.queue == nil && s.repo == nil {
+		s.logger.WarnContext(ctx, ErrNoSink.Error()+"; captured traffic will be discarded")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(min(s.sessions.IdleTimeout(), time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			s.drain()
+			return nil
+		case now := <-ticker.C:
+			s.sessions.Evict(now)
+			if s.dedup != nil {
+				s.dedup.evict(now)
+			}
+		}
+	}
+}
+
+func (s *Service) loop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-s.buffer:
+			if err := s.handle(ctx, t); err != nil && !errors.Is(err, ErrNoSink) {
+				s.logger.ErrorContext(ctx, fmt.Sprintf("capture %s: %v", t.ID, err))
+			}
+		}
+	}
+}
+
+// drain flushes whatever is still buffered once the proxy has stopped
+// accepting requests.
+func (s *Service) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		select {
+		case t := <-s.buffer:
+			if err := s.handle(ctx, t); err != nil && !errors.Is(err, ErrNoSink) {
+				s.logger.Error(fmt.Sprintf("capture %s: %v", t.ID, err))
+			}
+		default:
+			if n := s.dropped.Load(); n > 0 {
+				s.logger.Warn(fmt.Sprintf("capture dropped %d records because the buffer was full", n))
+			}
+			if n := s.deduplicated.Load(); n > 0 {
+				s.logger.Info(fmt.Sprintf("capture skipped %d duplicate requests", n))
+			}
+			return
+		}
+	}
+}
+
+// handle offloads bodies and hands the record to the sink. A record whose
+// bodies could not be stored is still persisted, with hashes only.
+func (s *Service) handle(ctx context.Context, t traffic.CapturedTraffic) error {
+	if err := payload.Offload(ctx, s.opts.Blobs, &t); err != nil {
+		s.logger.WarnContext(ctx, fmt.Sprintf("store bodies of capture %s: %v", t.ID, err))
+		t.Request.Body.Data = nil
+		t.Response.Body.Data = nil
+	}
+	return s.persist(ctx, t)
+}
+
+func (s *Service) persist(ctx context.Context, t traffic.CapturedTraffic) error {
+	if s.queue != nil {
+		return s.queue.EnqueueCapturedTraffic(ctx, t)
+	}
+	if s.repo != nil {
+		return s.repo.SaveCapturedTraffic(ctx, t)
+	}
+	return ErrNoSink
 }
@@ -0,0 +1,43 @@
+package capture
+
+import (
+	"sync"
+	"time"
+)
+
+// deduper remembers request keys for a fixed window so repeats of the same
+// request (client retries, double submits, tight polling) are recorded once.
+type deduper struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newDeduper(window time.Duration) *deduper {
+	return &deduper{window: window, seen: make(map[string]time.Time)}
+}
+
+// duplicate reports whether key was already seen within the window ending
+// at at, and records it otherwise.
+func (d *deduper) duplicate(key string, at time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if last, ok := d.seen[key]; ok && at.Sub(last) <= d.window {
+		return true
+	}
+	d.seen[key] = at
+	return false
+}
+
+func (d *deduper) evict(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, last := range d.seen {
+		if now.Sub(last) > d.window {
+			delete(d.seen, key)
+		}
+	}
+}
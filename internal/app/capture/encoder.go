@@ -0,0 +1,49 @@
+package capture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"synthema/internal/domain/traffic"
+)
+
+// bodyRecorder passes a body through unchanged while keeping the first
+// limit bytes and hashing the whole stream.
+type bodyRecorder struct {
+	io.ReadCloser
+	limit int64
+	buf   bytes.Buffer
+	hash  hash.Hash
+	size  int64
+}
+
+func newBodyRecorder(rc io.ReadCloser, limit int64) *bodyRecorder {
+	return &bodyRecorder{ReadCloser: rc, limit: limit, hash: sha256.New()}
+}
+
+func (b *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.hash.Write(p[:n])
+		b.size += int64(n)
+		if remaining := b.limit - int64(b.buf.Len()); remaining > 0 {
+			b.buf.Write(p[:min(int64(n), remaining)])
+		}
+	}
+	return n, err
+}
+
+func (b *bodyRecorder) body() traffic.Body {
+	if b.size == 0 {
+		return traffic.Body{}
+	}
+	return traffic.Body{
+		Data:      bytes.Clone(b.buf.Bytes()),
+		Hash:      hex.EncodeToString(b.hash.Sum(nil)),
+		Size:      b.size,
+		Truncated: b.size > int64(b.buf.Len()),
+	}
+}
@@ -0,0 +1,256 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"synthema/internal/adapters/grpcwire"
+	"synthema/internal/domain/traffic"
+	"synthema/internal/observability"
+)
+
+const defaultMaxBodyBytes = 1 << 20
+
+// Interceptor is a reverse proxy that forwards every request to the
+// upstream of the source environment and records the exchange.
+type Interceptor struct {
+	logger  *observability.Logger
+	proxy   *httputil.ReverseProxy
+	service *Service
+	opts    InterceptorOptions
+}
+
+type InterceptorOptions struct {
+	MaxBodyBytes int64
+	// SessionKey extracts the external session key. Requests without one
+	// are grouped by client IP.
+	SessionKey KeyExtractor
+	// Policies decides which requests are recorded. Nil records all.
+	Policies *PolicySource
+	// UpstreamHTTP2 talks HTTP/2 to the upstream, over cleartext for
+	// http:// upstreams, as gRPC backends require.
+	UpstreamHTTP2 bool
+}
+
+type exchangeKey struct{}
+
+// exchange collects the upstream response while the proxy streams it back
+// to the client.
+type exchange struct {
+	maxBodyBytes int64
+	response     *http.Response
+	body         *bodyRecorder
+	ws           *wsRecorder
+}
+
+func NewInterceptor(logger *observability.Logger, upstream *url.URL, service *Service, opts InterceptorOptions) *Interceptor {
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if opts.SessionKey == nil {
+		opts.SessionKey = ClientIPKey()
+	}
+	i := &Interceptor{logger: logger, service: service, opts: opts}
+	i.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream)
+			r.SetXForwarded()
+			if isWebSocketUpgrade(r.In.Header) {
+				// Without extensions no permessage-deflate is negotiated,
+				// so recorded frames carry plain payloads.
+				r.Out.Header.Del("Sec-WebSocket-Extensions")
+			}
+		},
+		ModifyResponse: i.recordResponse,
+		ErrorHandler:   i.handleProxyError,
+	}
+	if opts.UpstreamHTTP2 {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Protocols = new(http.Protocols)
+		if upstream.Scheme == "http" {
+			transport.Protocols.SetUnencryptedHTTP2(true)
+		} else {
+			transport.Protocols.SetHTTP2(true)
+		}
+		i.proxy.Transport = transport
+		// Flush every write so streamed gRPC responses are not held back.
+		i.proxy.FlushInterval = -1
+	}
+	return i
+}
+
+func (i *Interceptor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	capturedAt := time.Now().UTC()
+	headers := r.Header.Clone()
+	sessionKey := i.opts.SessionKey(r)
+	if sessionKey == "" {
+		sessionKey = clientIP(r)
+	}
+
+	maxBodyBytes := i.opts.MaxBodyBytes
+	if i.opts.Policies != nil {
+		policy := i.opts.Policies.Current()
+		if !policy.Allow(r.Method, r.URL.Path, sessionKey, capturedAt) {
+			i.proxy.ServeHTTP(w, r)
+			return
+		}
+		if n := policy.MaxBodyBytes(); n > 0 {
+			maxBodyBytes = n
+		}
+	}
+
+	var reqBody *bodyRecorder
+	if r.Body != nil && r.Body != http.NoBody {
+		reqBody = newBodyRecorder(r.Body, maxBodyBytes)
+		r.Body = reqBody
+	}
+
+	ex := &exchange{maxBodyBytes: maxBodyBytes}
+	r = r.WithContext(context.WithValue(r.Context(), exchangeKey{}, ex))
+
+	i.proxy.ServeHTTP(w, r)
+
+	if ex.response == nil {
+		// The upstream never answered, so there is nothing to compare a
+		// replay against.
+		return
+	}
+
+	t := traffic.CapturedTraffic{
+		ID:                 traffic.CaptureID(uuid.NewString()),
+		CapturedAt:         capturedAt,
+		ExternalSessionKey: sessionKey,
+		Method:             r.Method,
+		URL:                originalURL(r),
+		Request: traffic.Request{
+			Scheme:      requestScheme(r),
+			Host:        r.Host,
+			Path:        r.URL.Path,
+			QueryString: r.URL.RawQuery,
+			Headers:     headers,
+		},
+		Response: traffic.Response{
+			StatusCode: ex.response.StatusCode,
+			Headers:    ex.response.Header.Clone(),
+			Trailers:   ex.response.Trailer.Clone(),
+		},
+		Latency:  time.Since(capturedAt),
+		ClientIP: clientIP(r),
+	}
+	if reqBody != nil {
+		t.Request.Body = reqBody.body()
+	}
+	if ex.body != nil {
+		t.Response.Body = ex.body.body()
+	}
+	if grpcwire.IsGRPC(headers) && !recordGRPC(&t) {
+		return
+	}
+	if ex.ws != nil {
+		frames, ok := ex.ws.result()
+		if !ok {
+			return
+		}
+		t.Protocol = traffic.ProtocolWebSocket
+		t.Frames = frames
+		// The proxy returns when the connection closes; the latency of
+		// interest is that of the upgrade.
+		t.Latency = ex.ws.start.Sub(capturedAt)
+	}
+
+	i.service.Capture(t)
+}
+
+// recordGRPC replaces the framed bodies of a gRPC exchange with the unary
+// messages they carry. Streaming calls and calls whose bodies were
+// truncated cannot be replayed and are not recorded.
+func recordGRPC(t *traffic.CapturedTraffic) bool {
+	service, method, ok := grpcwire.SplitMethod(t.Request.Path)
+	if !ok {
+		return false
+	}
+	bodies := []struct {
+		body     *traffic.Body
+		encoding string
+	}{
+		{&t.Request.Body, t.Request.Headers.Get("Grpc-Encoding")},
+		{&t.Response.Body, t.Response.Headers.Get("Grpc-Encoding")},
+	}
+	for _, b := range bodies {
+		if b.body.Empty() {
+			// Trailers-only responses carry no message.
+			continue
+		}
+		if b.body.Truncated {
+			return false
+		}
+		msg, err := grpcwire.Unframe(b.body.Data, b.encoding)
+		if err != nil {
+			return false
+		}
+		*b.body = traffic.NewBody(msg, 0)
+	}
+	t.Protocol = traffic.ProtocolGRPC
+	t.GRPC = &traffic.GRPCCall{Service: service, Method: method}
+	return true
+}
+
+func (i *Interceptor) recordResponse(resp *http.Response) error {
+	ex, ok := resp.Request.Context().Value(exchangeKey{}).(*exchange)
+	if !ok {
+		return nil
+	}
+	ex.response = resp
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		if conn, ok := resp.Body.(io.ReadWriteCloser); ok && isWebSocketUpgrade(resp.Header) {
+			ex.ws = newWSRecorder(conn, ex.maxBodyBytes)
+			resp.Body = ex.ws
+		}
+		return nil
+	}
+	if resp.Body != nil && resp.Body != http.NoBody {
+		ex.body = newBodyRecorder(resp.Body, ex.maxBodyBytes)
+		resp.Body = ex.body
+	}
+	return nil
+}
+
+func (i *Interceptor) handleProxyError(w http.ResponseWriter, r *http.Request, err error) {
+	i.logger.ErrorContext(r.Context(), fmt.Sprintf("proxy %s %s: %v", r.Method, r.URL.Path, err))
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+func originalURL(r *http.Request) string {
+	u := url.URL{Scheme: requestScheme(r), Host: r.Host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+	return u.String()
+}
+
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func clientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		if ip := strings.TrimSpace(first); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
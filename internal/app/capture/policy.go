@@ -0,0 +1,197 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"synthema/internal/domain/traffic"
+	"synthema/internal/observability"
+	"synthema/internal/ports/repository"
+	"synthema/pkg/pathmatch"
+)
+
+const defaultPolicyRefresh = 30 * time.Second
+
+// PolicyEnforcer is a compiled CapturePolicy. It decides per request
+// whether the exchange is recorded; the proxy forwards every request
+// regardless.
+type PolicyEnforcer struct {
+	policy traffic.CapturePolicy
+	limits []*routeLimiter
+}
+
+func NewPolicyEnforcer(policy traffic.CapturePolicy) *PolicyEnforcer {
+	e := &PolicyEnforcer{policy: policy}
+	for _, l := range policy.RouteLimits {
+		e.limits = append(e.limits, newRouteLimiter(l))
+	}
+	return e
+}
+
+// MaxBodyBytes returns the policy's body cap, or zero when unset.
+func (e *PolicyEnforcer) MaxBodyBytes() int64 {
+	return e.policy.MaxBodyBytes
+}
+
+// Allow reports whether a request should be captured. Filters are checked
+// first, then session sampling and finally route rate limits, so tokens
+// are only spent on requests that would otherwise be recorded.
+func (e *PolicyEnforcer) Allow(method, urlPath, sessionKey string, now time.Time) bool {
+	p := e.policy
+	if len(p.IncludeMethods) > 0 && !containsFold(p.IncludeMethods, method) {
+		return false
+	}
+	if containsFold(p.ExcludeMethods, method) {
+		return false
+	}
+	if len(p.IncludePaths) > 0 && !matchAnyPath(p.IncludePaths, urlPath) {
+		return false
+	}
+	if matchAnyPath(p.ExcludePaths, urlPath) {
+		return false
+	}
+	if p.SamplePercent != nil && !sampled(sessionKey, *p.SamplePercent) {
+		return false
+	}
+	for _, l := range e.limits {
+		if l.matches(method, urlPath) && !l.allow(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// sampled buckets the session key into 10000 slots so the same session is
+// always either in or out.
+func sampled(sessionKey string, percent float64) bool {
+	if percent >= 100 {
+		return true
+	}
+	if percent <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(sessionKey))
+	return float64(h.Sum64()%10000) < percent*100
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyPath(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if pathmatch.Match(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeLimiter is a token bucket shared by every request matching a route.
+type routeLimiter struct {
+	limit traffic.RouteLimit
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRouteLimiter(l traffic.RouteLimit) *routeLimiter {
+	if l.Burst <= 0 {
+		l.Burst = max(1, int(l.RPS))
+	}
+	return &routeLimiter{limit: l, tokens: float64(l.Burst)}
+}
+
+func (l *routeLimiter) matches(method, urlPath string) bool {
+	if l.limit.Method != "" && !strings.EqualFold(l.limit.Method, method) {
+		return false
+	}
+	return pathmatch.Match(l.limit.Path, urlPath)
+}
+
+func (l *routeLimiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens = min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limit.RPS)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// PolicySource keeps the current enforcer for an environment (and
+// optionally a shadow target) and reloads it periodically. Without a
+// repository it always captures everything.
+type PolicySource struct {
+	logger *observability.Logger
+	repo   repository.CapturePolicyRepository
+
+	environmentID  string
+	shadowTargetID string
+	refresh        time.Duration
+
+	current atomic.Pointer[PolicyEnforcer]
+}
+
+func NewPolicySource(logger *observability.Logger, repo repository.CapturePolicyRepository, environmentID, shadowTargetID string, refresh time.Duration) *PolicySource {
+	if refresh <= 0 {
+		refresh = defaultPolicyRefresh
+	}
+	s := &PolicySource{logger: logger, repo: repo, environmentID: environmentID, shadowTargetID: shadowTargetID, refresh: refresh}
+	s.current.Store(NewPolicyEnforcer(traffic.CapturePolicy{}))
+	return s
+}
+
+func (s *PolicySource) Current() *PolicyEnforcer {
+	return s.current.Load()
+}
+
+// Load fetches the policy once. A failed load keeps the previous policy.
+func (s *PolicySource) Load(ctx context.Context) error {
+	if s.repo == nil {
+		return nil
+	}
+	policy, err := s.repo.LoadCapturePolicy(ctx, s.environmentID, s.shadowTargetID)
+	if err != nil {
+		return err
+	}
+	s.current.Store(NewPolicyEnforcer(policy))
+	return nil
+}
+
+func (s *PolicySource) Run(ctx context.Context) error {
+	if s.repo == nil {
+		<-ctx.Done()
+		return nil
+	}
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := s.Load(ctx); err != nil && ctx.Err() == nil {
+				s.logger.WarnContext(ctx, fmt.Sprintf("reload capture policy: %v", err))
+			}
+		}
+	}
+}
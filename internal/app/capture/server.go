@@ -0,0 +1,62 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"synthema/internal/config"
+	"synthema/internal/observability"
+)
+
+type Server struct {
+	srv           *http.Server
+	listenAddr    string
+	shutdownGrace time.Duration
+	logger        *observability.Logger
+}
+
+func NewServer(cfg config.Config, logger *observability.Logger, handler http.Handler) *Server {
+	listenAddr := fmt.Sprintf("%s:%d", cfg.Capture.Host, cfg.Capture.Port)
+	srv := &http.Server{
+		Addr:              listenAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if cfg.Capture.HTTP2 {
+		// gRPC clients speak HTTP/2 without TLS (h2c) to the proxy.
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return &Server{
+		srv:           srv,
+		listenAddr:    listenAddr,
+		shutdownGrace: cfg.ShutdownGracePeriod,
+		logger:        logger,
+	}
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		s.logger.Info("capture proxy listening on " + s.listenAddr)
+		errCh <- s.srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownGrace)
+		defer cancel()
+		_ = s.srv.Shutdown(shutdownCtx)
+		return nil
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
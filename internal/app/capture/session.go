@@ -0,0 +1,154 @@
+package capture
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"synthema/internal/domain/traffic"
+)
+
+const defaultSessionIdleTimeout = 30 * time.Minute
+
+// KeyExtractor derives the external session key of a request. An empty key
+// means the request carries no session marker.
+type KeyExtractor func(r *http.Request) string
+
+func HeaderKey(name string) KeyExtractor {
+	return func(r *http.Request) string {
+		return strings.TrimSpace(r.Header.Get(name))
+	}
+}
+
+func CookieKey(name string) KeyExtractor {
+	return func(r *http.Request) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
+
+// JWTSubjectKey reads the sub claim of a bearer token in the given header.
+// The signature is not verified; the claim is only used for grouping.
+func JWTSubjectKey(header string) KeyExtractor {
+	return func(r *http.Request) string {
+		token, ok := strings.CutPrefix(r.Header.Get(header), "Bearer ")
+		if !ok {
+			return ""
+		}
+		parts := strings.Split(strings.TrimSpace(token), ".")
+		if len(parts) != 3 {
+			return ""
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return ""
+		}
+		var claims struct {
+			Sub string `json:"sub"`
+		}
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			return ""
+		}
+		return claims.Sub
+	}
+}
+
+func ClientIPKey() KeyExtractor {
+	return clientIP
+}
+
+// ParseKeyExtractor builds an extractor from a spec such as
+// "header:X-Session-Id", "cookie:sid", "jwt_sub", "jwt_sub:X-Auth" or
+// "client_ip".
+func ParseKeyExtractor(spec string) (KeyExtractor, error) {
+	kind, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	arg = strings.TrimSpace(arg)
+	switch strings.ToLower(kind) {
+	case "header":
+		if arg == "" {
+			return nil, fmt.Errorf("session key %q needs a header name", spec)
+		}
+		return HeaderKey(arg), nil
+	case "cookie":
+		if arg == "" {
+			return nil, fmt.Errorf("session key %q needs a cookie name", spec)
+		}
+		return CookieKey(arg), nil
+	case "jwt_sub":
+		if arg == "" {
+			arg = "Authorization"
+		}
+		return JWTSubjectKey(arg), nil
+	case "", "client_ip":
+		return ClientIPKey(), nil
+	default:
+		return nil, fmt.Errorf("unknown session key extractor %q", spec)
+	}
+}
+
+// Sessionizer maps external session keys to traffic sessions. A key that
+// has been idle for longer than the timeout starts a new session.
+type Sessionizer struct {
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*openSession
+}
+
+type openSession struct {
+	id       traffic.SessionID
+	lastSeen time.Time
+}
+
+func NewSessionizer(idleTimeout time.Duration) *Sessionizer {
+	if idleTimeout <= 0 {
+		idleTimeout = defaultSessionIdleTimeout
+	}
+	return &Sessionizer{idleTimeout: idleTimeout, sessions: make(map[string]*openSession)}
+}
+
+func (s *Sessionizer) IdleTimeout() time.Duration {
+	return s.idleTimeout
+}
+
+// Assign returns the session for key at the given time, opening a new one
+// when the key is unknown or its session went idle.
+func (s *Sessionizer) Assign(key string, at time.Time) traffic.SessionID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	open, ok := s.sessions[key]
+	if !ok || at.Sub(open.lastSeen) > s.idleTimeout {
+		open = &openSession{id: traffic.SessionID(uuid.NewString()), lastSeen: at}
+		s.sessions[key] = open
+		return open.id
+	}
+	if at.After(open.lastSeen) {
+		open.lastSeen = at
+	}
+	return open.id
+}
+
+// Evict forgets sessions idle at now and returns how many were dropped.
+func (s *Sessionizer) Evict(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evicted := 0
+	for key, open := range s.sessions {
+		if now.Sub(open.lastSeen) > s.idleTimeout {
+			delete(s.sessions, key)
+			evicted++
+		}
+	}
+	return evicted
+}
@@ -0,0 +1,103 @@
+package capture
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"synthema/internal/adapters/wsframe"
+	"synthema/internal/domain/traffic"
+)
+
+// maxWebSocketFrames bounds the messages kept for one connection. Longer
+// connections are not recorded.
+const maxWebSocketFrames = 10000
+
+// wsRecorder wraps the upgraded upstream connection the proxy copies
+// between client and upstream: writes carry client frames, reads carry
+// server frames. It only observes; the bytes pass through untouched.
+type wsRecorder struct {
+	io.ReadWriteCloser
+	start time.Time
+
+	client    *wsframe.Parser
+	server    *wsframe.Parser
+	clientMsg wsframe.Assembler
+	serverMsg wsframe.Assembler
+
+	mu       sync.Mutex
+	frames   []traffic.Frame
+	complete bool
+}
+
+func newWSRecorder(conn io.ReadWriteCloser, maxFrameBytes int64) *wsRecorder {
+	return &wsRecorder{
+		ReadWriteCloser: conn,
+		start:           time.Now(),
+		client:          wsframe.NewParser(maxFrameBytes),
+		server:          wsframe.NewParser(maxFrameBytes),
+		complete:        true,
+	}
+}
+
+func (r *wsRecorder) Read(p []byte) (int, error) {
+	n, err := r.ReadWriteCloser.Read(p)
+	if n > 0 {
+		r.observe(traffic.FrameFromServer, r.server, &r.serverMsg, p[:n])
+	}
+	return n, err
+}
+
+func (r *wsRecorder) Write(p []byte) (int, error) {
+	n, err := r.ReadWriteCloser.Write(p)
+	if n > 0 {
+		r.observe(traffic.FrameFromClient, r.client, &r.clientMsg, p[:n])
+	}
+	return n, err
+}
+
+// observe runs on the copy goroutine of one direction, so the parser and
+// assembler need no locking; the shared frame list does.
+func (r *wsRecorder) observe(dir traffic.FrameDirection, parser *wsframe.Parser, asm *wsframe.Assembler, p []byte) {
+	frames, err := parser.Write(p)
+	at := time.Since(r.start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.complete {
+		return
+	}
+	if err != nil {
+		r.complete = false
+	}
+	for _, f := range frames {
+		msg, ok := asm.Add(f)
+		if !ok {
+			continue
+		}
+		if len(r.frames) == maxWebSocketFrames {
+			r.complete = false
+			return
+		}
+		r.frames = append(r.frames, traffic.Frame{
+			Offset:    at,
+			Direction: dir,
+			Opcode:    int(msg.Opcode),
+			Body:      traffic.NewBody(msg.Payload, 0),
+		})
+	}
+}
+
+// result returns the recorded messages, or false when some could not be
+// recorded and the connection cannot be replayed faithfully.
+func (r *wsRecorder) result() ([]traffic.Frame, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.frames, r.complete
+}
+
+func isWebSocketUpgrade(h http.Header) bool {
+	return strings.EqualFold(h.Get("Upgrade"), "websocket")
+}
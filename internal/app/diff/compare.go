@@ -0,0 +1,235 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"synthema/internal/adapters/grpcwire"
+	"synthema/internal/adapters/wsframe"
+	"synthema/internal/domain/diff"
+	"synthema/internal/domain/traffic"
+)
+
+// Exchange is one side of a comparison: a response and its full body and,
+// for WebSocket connections, the server frames and their full payloads.
+type Exchange struct {
+	Response  traffic.Response
+	Body      []byte
+	Frames    []traffic.Frame
+	FrameData [][]byte
+}
+
+// Comparer diffs a replayed response against the captured one. JSON bodies
+// and gRPC messages, decoded with the descriptor set, are compared field
+// by field; anything else by hash. Bodies the capture only knows the size
+// of are not compared. WebSocket connections are compared by
+// the messages the server sent.
+type Comparer struct {
+	descriptors *grpcwire.Descriptors
+}
+
+// NewComparer takes the descriptor set used to decode gRPC messages. Without
+// one, gRPC bodies are compared by hash.
+func NewComparer(descriptors *grpcwire.Descriptors) *Comparer {
+	return &Comparer{descriptors: descriptors}
+}
+
+func (c *Comparer) Compare(t traffic.CapturedTraffic, original, replayed Exchange) diff.Comparison {
+	var changes []diff.Change
+	if original.Response.StatusCode != replayed.Response.StatusCode {
+		changes = append(changes, diff.Change{
+			Path:     "status",
+			Kind:     diff.ChangeModified,
+			Original: original.Response.StatusCode,
+			Replayed: replayed.Response.StatusCode,
+		})
+	}
+	if t.Protocol == traffic.ProtocolGRPC {
+		origCode, origMsg := grpcwire.Status(original.Response.Headers, original.Response.Trailers)
+		replCode, replMsg := grpcwire.Status(replayed.Response.Headers, replayed.Response.Trailers)
+		if origCode != replCode {
+			changes = append(changes, diff.Change{Path: "grpc.status", Kind: diff.ChangeModified, Original: origCode, Replayed: replCode})
+		} else if origMsg != replMsg {
+			changes = append(changes, diff.Change{Path: "grpc.message", Kind: diff.ChangeModified, Original: origMsg, Replayed: replMsg})
+		}
+	}
+	if t.Protocol == traffic.ProtocolWebSocket {
+		changes = append(changes, compareFrames(original, replayed)...)
+	} else {
+		changes = append(changes, c.compareBodies(t, original, replayed)...)
+	}
+
+	status := diff.StatusMatched
+	if len(changes) > 0 {
+		status = diff.StatusMismatched
+	}
+	return diff.Comparison{Status: status, Changes: changes}
+}
+
+func (c *Comparer) compareBodies(t traffic.CapturedTraffic, original, replayed Exchange) []diff.Change {
+	origBody, replBody := original.Response.Body, replayed.Response.Body
+	if origBody.Unrecorded() {
+		// Nothing of the captured body was kept, so only the status can
+		// be compared.
+		return nil
+	}
+	if !origBody.Truncated && !replBody.Truncated {
+		origValue, origOK := c.decode(t, original.Body)
+		replValue, replOK := c.decode(t, replayed.Body)
+		if origOK && replOK {
+			var changes []diff.Change
+			walk("body", origValue, replValue, &changes)
+			return changes
+		}
+	}
+	if origBody.Hash == replBody.Hash {
+		return nil
+	}
+	return []diff.Change{{Path: "body", Kind: diff.ChangeModified, Original: origBody.Hash, Replayed: replBody.Hash}}
+}
+
+// compareFrames pairs the server messages of both connections in order,
+// at paths like "frames[2]". Pings and pongs depend on timing alone and are
+// left out.
+func compareFrames(original, replayed Exchange) []diff.Change {
+	origFrames, origData := serverMessages(original)
+	replFrames, replData := serverMessages(replayed)
+
+	var changes []diff.Change
+	for i := 0; i < max(len(origFrames), len(replFrames)); i++ {
+		path := "frames[" + strconv.Itoa(i) + "]"
+		switch {
+		case i >= len(replFrames):
+			changes = append(changes, diff.Change{Path: path, Kind: diff.ChangeRemoved, Original: framePayload(origFrames[i], origData[i])})
+		case i >= len(origFrames):
+			changes = append(changes, diff.Change{Path: path, Kind: diff.ChangeAdded, Replayed: framePayload(replFrames[i], replData[i])})
+		case origFrames[i].Opcode != replFrames[i].Opcode:
+			changes = append(changes, diff.Change{Path: path + ".opcode", Kind: diff.ChangeModified, Original: origFrames[i].Opcode, Replayed: replFrames[i].Opcode})
+		default:
+			origValue, origOK := decodeJSON(origData[i])
+			replValue, replOK := decodeJSON(replData[i])
+			if origOK && replOK {
+				walk(path, origValue, replValue, &changes)
+			} else if origFrames[i].Body.Hash != replFrames[i].Body.Hash {
+				changes = append(changes, diff.Change{Path: path, Kind: diff.ChangeModified, Original: framePayload(origFrames[i], origData[i]), Replayed: framePayload(replFrames[i], replData[i])})
+			}
+		}
+	}
+	return changes
+}
+
+func serverMessages(ex Exchange) ([]traffic.Frame, [][]byte) {
+	var frames []traffic.Frame
+	var data [][]byte
+	for i, f := range ex.Frames {
+		if f.Direction != traffic.FrameFromServer || f.Opcode == wsframe.OpPing || f.Opcode == wsframe.OpPong {
+			continue
+		}
+		frames = append(frames, f)
+		if i < len(ex.FrameData) {
+			data = append(data, ex.FrameData[i])
+		} else {
+			data = append(data, f.Body.Data)
+		}
+	}
+	return frames, data
+}
+
+// framePayload reports text messages as text and anything else by hash.
+func framePayload(f traffic.Frame, data []byte) any {
+	if f.Opcode == wsframe.OpText && utf8.Valid(data) {
+		return string(data)
+	}
+	return f.Body.Hash
+}
+
+// decode turns a body into a generic JSON value, if it is JSON or a gRPC
+// message the descriptor set can decode.
+func (c *Comparer) decode(t traffic.CapturedTraffic, body []byte) (any, bool) {
+	if t.Protocol == traffic.ProtocolGRPC {
+		if c.descriptors == nil || t.GRPC == nil {
+			return nil, false
+		}
+		decoded, err := c.descriptors.DecodeJSON(t.GRPC.Service, t.GRPC.Method, true, body)
+		if err != nil {
+			return nil, false
+		}
+		body = decoded
+	}
+	return decodeJSON(body)
+}
+
+func decodeJSON(body []byte) (any, bool) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil, false
+	}
+	return v, true
+}
+
+func walk(path string, a, b any, changes *[]diff.Change) {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, seen := av[k]; !seen {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "." + k
+			aChild, inA := av[k]
+			bChild, inB := bv[k]
+			switch {
+			case !inB:
+				*changes = append(*changes, diff.Change{Path: child, Kind: diff.ChangeRemoved, Original: aChild})
+			case !inA:
+				*changes = append(*changes, diff.Change{Path: child, Kind: diff.ChangeAdded, Replayed: bChild})
+			default:
+				walk(child, aChild, bChild, changes)
+			}
+		}
+		return
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < max(len(av), len(bv)); i++ {
+			child := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(bv):
+				*changes = append(*changes, diff.Change{Path: child, Kind: diff.ChangeRemoved, Original: av[i]})
+			case i >= len(av):
+				*changes = append(*changes, diff.Change{Path: child, Kind: diff.ChangeAdded, Replayed: bv[i]})
+			default:
+				walk(child, av[i], bv[i], changes)
+			}
+		}
+		return
+	}
+	if fmt.Sprint(a) != fmt.Sprint(b) || typeName(a) != typeName(b) {
+		*changes = append(*changes, diff.Change{Path: path, Kind: diff.ChangeModified, Original: a, Replayed: b})
+	}
+}
+
+func typeName(v any) string {
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,34 @@
+package diff
+
+import (
+	"testing"
+
+	"synthema/internal/domain/diff"
+	"synthema/internal/domain/traffic"
+)
+
+func TestCompareSkipsUnrecordedBodies(t *testing.T) {
+	c := NewComparer(nil)
+	data := []byte("<html>replayed</html>")
+	replayed := Exchange{Response: traffic.Response{StatusCode: 200, Body: traffic.NewBody(data, 0)}, Body: data}
+
+	// Imported from an access log: only the size is known.
+	original := Exchange{Response: traffic.Response{StatusCode: 200, Body: traffic.Body{Size: 1234}}}
+	if got := c.Compare(traffic.CapturedTraffic{}, original, replayed); got.Status != diff.StatusMatched {
+		t.Fatalf("unrecorded body with equal status = %s %+v, want matched", got.Status, got.Changes)
+	}
+
+	original.Response.StatusCode = 404
+	got := c.Compare(traffic.CapturedTraffic{}, original, replayed)
+	if got.Status != diff.StatusMismatched || len(got.Changes) != 1 || got.Changes[0].Path != "status" {
+		t.Fatalf("unrecorded body with other status = %s %+v, want only a status change", got.Status, got.Changes)
+	}
+
+	// A recorded body that differs is still reported.
+	captured := []byte("<html>captured</html>")
+	original = Exchange{Response: traffic.Response{StatusCode: 200, Body: traffic.NewBody(captured, 0)}, Body: captured}
+	got = c.Compare(traffic.CapturedTraffic{}, original, replayed)
+	if len(got.Changes) != 1 || got.Changes[0].Path != "body" {
+		t.Fatalf("recorded body = %+v, want a body change", got.Changes)
+	}
+}
@@ -1,6 +1,11 @@
 package diff
 
 import (
+	"context"
+	"sort"
+
+	"synthema/internal/domain/diff"
+	"synthema/internal/domain/replay"
 	"synthema/internal/observability"
 	"synthema/internal/ports/repository"
 )
@@ -13,3 +18,52 @@ type Service struct {
 func NewService(logger *observability.Logger, repo repository.DiffRepository) *Service {
 	return &Service{logger: logger, repo: repo}
 }
+
+// JobEndpoints summarises a job's diff results per endpoint.
+func (s *Service) JobEndpoints(ctx context.Context, id replay.ReplayID) ([]diff.EndpointSummary, error) {
+	results, err := s.repo.ListJobDiffResults(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GroupByEndpoint(results), nil
+}
+
+// GroupByEndpoint folds results into one summary per request fingerprint,
+// endpoints with the most mismatches first. Results without a fingerprint
+// are grouped under their endpoint label.
+func (s *Service) GroupByEndpoint(results []diff.DiffResult) []diff.EndpointSummary {
+	index := make(map[string]int)
+	var groups []diff.EndpointSummary
+	for _, r := range results {
+		key := r.Fingerprint
+		if key == "" {
+			key = "endpoint:" + r.Endpoint
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, diff.EndpointSummary{Fingerprint: r.Fingerprint, Endpoint: r.Endpoint})
+		}
+		g := &groups[i]
+		g.Total++
+		switch r.Status {
+		case diff.StatusMatched:
+			g.Matched++
+		case diff.StatusMismatched:
+			g.Mismatched++
+		case diff.StatusError:
+			g.Errored++
+		case diff.StatusSkipped:
+			g.Skipped++
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Mismatched != groups[j].Mismatched {
+			return groups[i].Mismatched > groups[j].Mismatched
+		}
+		return groups[i].Endpoint < groups[j].Endpoint
+	})
+	return groups
+}
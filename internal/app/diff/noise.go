@@ -0,0 +1,98 @@
+package diff
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"synthema/internal/domain/diff"
+)
+
+var arrayIndex = regexp.MustCompile(`\[\d+\]`)
+
+// Noise learns, per endpoint, the paths at which two baseline responses to
+// the same request differed. Array indices are generalised, so noise in one
+// element of a list counts for every element.
+type Noise struct {
+	mu    sync.Mutex
+	paths map[string]map[string]bool
+}
+
+func NewNoise() *Noise {
+	return &Noise{paths: make(map[string]map[string]bool)}
+}
+
+// Learn records the changes between two baselines as noise.
+func (n *Noise) Learn(endpoint string, changes []diff.Change) {
+	if len(changes) == 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	paths := n.paths[endpoint]
+	if paths == nil {
+		paths = make(map[string]bool)
+		n.paths[endpoint] = paths
+	}
+	for _, c := range changes {
+		paths[noisePath(c.Path)] = true
+	}
+}
+
+// Add records noise paths learned earlier, such as those a stored diff
+// result lists.
+func (n *Noise) Add(endpoint string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	known := n.paths[endpoint]
+	if known == nil {
+		known = make(map[string]bool)
+		n.paths[endpoint] = known
+	}
+	for _, p := range paths {
+		known[p] = true
+	}
+}
+
+// Paths returns the endpoint's noise learned so far, sorted.
+func (n *Noise) Paths(endpoint string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	paths := make([]string, 0, len(n.paths[endpoint]))
+	for p := range n.paths[endpoint] {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Filter drops the changes at or below the endpoint's noise paths.
+func (n *Noise) Filter(endpoint string, changes []diff.Change) []diff.Change {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	paths := n.paths[endpoint]
+	kept := changes[:0:0]
+	for _, c := range changes {
+		if !isNoise(paths, noisePath(c.Path)) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+func isNoise(paths map[string]bool, path string) bool {
+	for p := range paths {
+		if path == p || strings.HasPrefix(path, p+".") || strings.HasPrefix(path, p+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func noisePath(path string) string {
+	return arrayIndex.ReplaceAllString(path, "[*]")
+}
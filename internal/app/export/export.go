@@ -0,0 +1,222 @@
+package export
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"synthema/internal/adapters/har"
+	"synthema/internal/app/payload"
+	"synthema/internal/domain/common"
+	"synthema/internal/domain/traffic"
+	"synthema/internal/observability"
+	"synthema/internal/ports/blob"
+	"synthema/internal/ports/repository"
+)
+
+type Format string
+
+const (
+	FormatHAR   Format = "har"
+	FormatJSONL Format = "jsonl"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(s))) {
+	case "", FormatHAR:
+		return FormatHAR, nil
+	case FormatJSONL, "ndjson":
+		return FormatJSONL, nil
+	default:
+		return "", fmt.Errorf("%w: export format %q", common.ErrInvalidInput, s)
+	}
+}
+
+// ContentType is the media type an export in this format is served as.
+func (f Format) ContentType() string {
+	if f == FormatJSONL {
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// Service writes a captured session out as HAR 1.2 or newline-delimited
+// JSON. Bodies are read back from the blob store when one is configured;
+// without it only their hashes and sizes are exported.
+type Service struct {
+	logger *observability.Logger
+	repo   repository.TrafficRepository
+	blobs  blob.Store
+}
+
+func NewService(logger *observability.Logger, repo repository.TrafficRepository, blobs blob.Store) *Service {
+	return &Service{logger: logger, repo: repo, blobs: blobs}
+}
+
+func (s *Service) Export(ctx context.Context, w io.Writer, sessionID traffic.SessionID, format Format) error {
+	sess, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	records, err := s.repo.ListSessionRequests(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatJSONL:
+		return s.writeJSONL(ctx, w, records)
+	default:
+		return s.writeHAR(ctx, w, sess, records)
+	}
+}
+
+func (s *Service) writeHAR(ctx context.Context, w io.Writer, sess traffic.Session, records []traffic.CapturedTraffic) error {
+	pageRef := string(sess.ID)
+	title := sess.ExternalSessionKey
+	if title == "" {
+		title = pageRef
+	}
+	startedAt := sess.StartedAt
+	if startedAt.IsZero() && len(records) > 0 {
+		startedAt = records[0].CapturedAt
+	}
+
+	doc := &har.HAR{Log: har.Log{
+		Version: "1.2",
+		Creator: har.Creator{Name: "synthema", Version: "1"},
+		Pages:   []har.Page{{StartedDateTime: startedAt, ID: pageRef, Title: title}},
+		Entries: make([]har.Entry, 0, len(records)),
+	}}
+	for _, t := range records {
+		reqBody, respBody := s.bodies(ctx, t)
+		entry := har.NewEntry(t, pageRef, reqBody, respBody)
+		if len(t.Frames) > 0 {
+			entry.WebSocketMessages = har.NewWebSocketMessages(t, s.frames(ctx, t))
+		}
+		doc.Log.Entries = append(doc.Log.Entries, entry)
+	}
+	return har.Encode(w, doc)
+}
+
+// jsonlRecord is one line of a JSONL export.
+type jsonlRecord struct {
+	ID          string        `json:"id"`
+	SessionID   string        `json:"session_id"`
+	SequenceNo  int           `json:"sequence_no"`
+	CapturedAt  time.Time     `json:"captured_at"`
+	Protocol    string        `json:"protocol,omitempty"`
+	Method      string        `json:"method"`
+	URL         string        `json:"url"`
+	Fingerprint string        `json:"fingerprint,omitempty"`
+	LatencyMS   int64         `json:"latency_ms"`
+	Request     jsonlRequest  `json:"request"`
+	Response    jsonlResponse `json:"response"`
+	Frames      []jsonlFrame  `json:"frames,omitempty"`
+}
+
+type jsonlRequest struct {
+	Headers http.Header `json:"headers,omitempty"`
+	jsonlBody
+}
+
+type jsonlResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	jsonlBody
+}
+
+type jsonlFrame struct {
+	OffsetMS  int64  `json:"offset_ms"`
+	Direction string `json:"direction"`
+	Opcode    int    `json:"opcode"`
+	jsonlBody
+}
+
+type jsonlBody struct {
+	Body       string `json:"body,omitempty"`
+	BodyBase64 string `json:"body_base64,omitempty"`
+	BodyHash   string `json:"body_hash,omitempty"`
+	BodySize   int64  `json:"body_size,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+}
+
+func (s *Service) writeJSONL(ctx context.Context, w io.Writer, records []traffic.CapturedTraffic) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, t := range records {
+		reqBody, respBody := s.bodies(ctx, t)
+		rec := jsonlRecord{
+			ID:          string(t.ID),
+			SessionID:   string(t.SessionID),
+			SequenceNo:  t.SequenceNo,
+			CapturedAt:  t.CapturedAt,
+			Protocol:    string(t.Protocol),
+			Method:      t.Method,
+			URL:         t.URL,
+			Fingerprint: t.Fingerprint,
+			LatencyMS:   t.Latency.Milliseconds(),
+			Request: jsonlRequest{
+				Headers:   t.Request.Headers,
+				jsonlBody: newJSONLBody(t.Request.Body, reqBody),
+			},
+			Response: jsonlResponse{
+				StatusCode: t.Response.StatusCode,
+				Headers:    t.Response.Headers,
+				jsonlBody:  newJSONLBody(t.Response.Body, respBody),
+			},
+		}
+		for i, data := range s.frames(ctx, t) {
+			f := t.Frames[i]
+			rec.Frames = append(rec.Frames, jsonlFrame{
+				OffsetMS:  f.Offset.Milliseconds(),
+				Direction: string(f.Direction),
+				Opcode:    f.Opcode,
+				jsonlBody: newJSONLBody(f.Body, data),
+			})
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newJSONLBody(b traffic.Body, data []byte) jsonlBody {
+	out := jsonlBody{BodyHash: b.Hash, BodySize: b.Size, Truncated: b.Truncated}
+	if utf8.Valid(data) {
+		out.Body = string(data)
+	} else {
+		out.BodyBase64 = base64.StdEncoding.EncodeToString(data)
+	}
+	return out
+}
+
+// bodies loads both bodies of a record. A body that cannot be loaded is
+// exported without content rather than failing the whole export.
+func (s *Service) bodies(ctx context.Context, t traffic.CapturedTraffic) ([]byte, []byte) {
+	return s.body(ctx, t, t.Request.Body), s.body(ctx, t, t.Response.Body)
+}
+
+// frames loads the payloads of a WebSocket record's frames, in order.
+func (s *Service) frames(ctx context.Context, t traffic.CapturedTraffic) [][]byte {
+	payloads := make([][]byte, len(t.Frames))
+	for i, f := range t.Frames {
+		payloads[i] = s.body(ctx, t, f.Body)
+	}
+	return payloads
+}
+
+func (s *Service) body(ctx context.Context, t traffic.CapturedTraffic, b traffic.Body) []byte {
+	data, err := payload.Load(ctx, s.blobs, b)
+	if err != nil {
+		s.logger.WarnContext(ctx, fmt.Sprintf("load body %s of capture %s: %v", b.Ref, t.ID, err))
+		return nil
+	}
+	return data
+}
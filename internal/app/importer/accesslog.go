@@ -0,0 +1,163 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"synthema/internal/adapters/accesslog"
+	"synthema/internal/app/capture"
+	"synthema/internal/domain/traffic"
+)
+
+const maxLogLineBytes = 1 << 20
+
+// AccessLogOptions controls how access log lines are grouped and addressed.
+type AccessLogOptions struct {
+	// SessionKey is "client_ip" (default) or "header:<Name>". Lines without
+	// the header fall back to the client IP.
+	SessionKey         string
+	SessionIdleTimeout time.Duration
+	// Host and Scheme fill in what the log format does not record.
+	Host   string
+	Scheme string
+}
+
+// ImportAccessLog stores the GET requests of an access log as bodyless
+// sessions. Lines are expected in chronological order, as servers write
+// them; lines that do not parse are counted and skipped.
+func (s *Service) ImportAccessLog(ctx context.Context, r io.Reader, parser accesslog.Parser, opts AccessLogOptions) (Result, error) {
+	sessionKey, err := parseLogSessionKey(opts.SessionKey)
+	if err != nil {
+		return Result{}, err
+	}
+	if opts.Scheme == "" {
+		opts.Scheme = "http"
+	}
+	sessions := capture.NewSessionizer(opts.SessionIdleTimeout)
+
+	var (
+		res     Result
+		batch   []traffic.CapturedTraffic
+		seen    = make(map[traffic.SessionID]struct{})
+		scanner = bufio.NewScanner(r)
+	)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineBytes)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		e, err := parser.Parse(line)
+		if err != nil {
+			res.Skipped++
+			s.logger.WarnContext(ctx, fmt.Sprintf("access log line %d: %v", lineNo, err))
+			continue
+		}
+		if e.Method != http.MethodGet {
+			res.Skipped++
+			continue
+		}
+
+		t, err := logEntryTraffic(e, opts)
+		if err != nil {
+			res.Skipped++
+			s.logger.WarnContext(ctx, fmt.Sprintf("access log line %d: %v", lineNo, err))
+			continue
+		}
+		key := sessionKey(e, t.ClientIP)
+		t.ExternalSessionKey = key
+		t.SessionID = sessions.Assign(key, t.CapturedAt)
+		seen[t.SessionID] = struct{}{}
+
+		batch = append(batch, t)
+		if len(batch) >= s.opts.BatchSize {
+			if err := s.save(ctx, batch); err != nil {
+				return res, err
+			}
+			res.Requests += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return res, err
+	}
+	if err := s.save(ctx, batch); err != nil {
+		return res, err
+	}
+	res.Requests += len(batch)
+	res.Sessions = len(seen)
+	return res, nil
+}
+
+func logEntryTraffic(e accesslog.Entry, opts AccessLogOptions) (traffic.CapturedTraffic, error) {
+	target, err := url.ParseRequestURI(e.Target)
+	if err != nil {
+		return traffic.CapturedTraffic{}, fmt.Errorf("request target %q: %w", e.Target, err)
+	}
+	host := e.Host
+	if host == "" {
+		host = opts.Host
+	}
+	scheme := e.Scheme
+	if scheme == "" {
+		scheme = opts.Scheme
+	}
+	u := url.URL{Scheme: scheme, Host: host, Path: target.Path, RawPath: target.RawPath, RawQuery: target.RawQuery}
+
+	clientIP := e.ClientIP
+	if xff := e.Headers.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		clientIP = strings.TrimSpace(first)
+	}
+
+	return traffic.CapturedTraffic{
+		ID:         traffic.CaptureID(uuid.NewString()),
+		CapturedAt: e.Time,
+		Method:     e.Method,
+		URL:        u.String(),
+		Request: traffic.Request{
+			Scheme:      scheme,
+			Host:        host,
+			Path:        target.Path,
+			QueryString: target.RawQuery,
+			Headers:     e.Headers,
+		},
+		Response: traffic.Response{
+			StatusCode: e.Status,
+			// Access logs only carry the size, so the body is
+			// Unrecorded and replay diffs the status alone.
+			Body: traffic.Body{Size: e.Bytes},
+		},
+		Latency:  e.Duration,
+		ClientIP: clientIP,
+	}, nil
+}
+
+func parseLogSessionKey(spec string) (func(e accesslog.Entry, clientIP string) string, error) {
+	kind, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	switch strings.ToLower(kind) {
+	case "", "client_ip", "ip":
+		return func(_ accesslog.Entry, clientIP string) string { return clientIP }, nil
+	case "header":
+		if arg == "" {
+			return nil, fmt.Errorf("session key %q needs a header name", spec)
+		}
+		name := strings.TrimSpace(arg)
+		return func(e accesslog.Entry, clientIP string) string {
+			if v := e.Headers.Get(name); v != "" {
+				return v
+			}
+			return clientIP
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown access log session key %q", spec)
+	}
+}
@@ -0,0 +1,143 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"synthema/internal/adapters/har"
+	"synthema/internal/app/payload"
+	"synthema/internal/app/privacy"
+	"synthema/internal/domain/traffic"
+	"synthema/internal/observability"
+	"synthema/internal/ports/blob"
+	"synthema/internal/ports/repository"
+)
+
+const (
+	defaultBatchSize    = 500
+	defaultMaxBodyBytes = 1 << 20
+)
+
+// Service loads traffic recorded elsewhere into traffic_sessions and
+// traffic_requests, applying the same fingerprinting, scrubbing and body
+// offloading as live capture.
+type Service struct {
+	logger *observability.Logger
+	repo   repository.TrafficRepository
+	opts   Options
+}
+
+type Options struct {
+	ProjectID      string
+	EnvironmentID  string
+	ShadowTargetID string
+	MaxBodyBytes   int64
+	BatchSize      int
+
+	Fingerprinter *traffic.Fingerprinter
+	// Sanitizer defaults to scrubbing privacy.DefaultScrubHeaders and
+	// discarding client IPs and session keys.
+	Sanitizer *privacy.Sanitizer
+	Blobs     blob.Store
+}
+
+// Result counts what an import stored and what it skipped.
+type Result struct {
+	Sessions int
+	Requests int
+	Skipped  int
+}
+
+func NewService(logger *observability.Logger, repo repository.TrafficRepository, opts Options) *Service {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if opts.Sanitizer == nil {
+		opts.Sanitizer = privacy.NewSanitizer(nil, nil)
+	}
+	return &Service{logger: logger, repo: repo, opts: opts}
+}
+
+// ImportHAR stores every page of a HAR 1.2 document as one session, its
+// entries ordered by start time. Entries that belong to no page share one
+// extra session.
+func (s *Service) ImportHAR(ctx context.Context, r io.Reader) (Result, error) {
+	doc, err := har.Decode(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	sessions := make(map[string]traffic.SessionID, len(doc.Log.Pages))
+	for _, p := range doc.Log.Pages {
+		sessions[p.ID] = traffic.SessionID(uuid.NewString())
+	}
+
+	entries := append([]har.Entry(nil), doc.Log.Entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+
+	records := make([]traffic.CapturedTraffic, 0, len(entries))
+	for n, e := range entries {
+		t, err := e.CapturedTraffic(s.opts.MaxBodyBytes)
+		if err != nil {
+			return Result{}, fmt.Errorf("har entry %d: %w", n, err)
+		}
+		sessionID, ok := sessions[e.PageRef]
+		if !ok {
+			sessionID = traffic.SessionID(uuid.NewString())
+			sessions[e.PageRef] = sessionID
+		}
+		t.SessionID = sessionID
+		t.ExternalSessionKey = e.PageRef
+		records = append(records, t)
+	}
+
+	if err := s.save(ctx, records); err != nil {
+		return Result{}, err
+	}
+	return Result{Sessions: countSessions(records), Requests: len(records)}, nil
+}
+
+// save prepares records like live capture does and writes them in batches.
+// Records must already be in capture order within each session.
+func (s *Service) save(ctx context.Context, records []traffic.CapturedTraffic) error {
+	for i := range records {
+		t := &records[i]
+		t.ProjectID = s.opts.ProjectID
+		t.EnvironmentID = s.opts.EnvironmentID
+		t.ShadowTargetID = s.opts.ShadowTargetID
+		if s.opts.Fingerprinter != nil {
+			t.Fingerprint = s.opts.Fingerprinter.Fingerprint(t.Method, t.Request.Path, t.Request.QueryString, t.Request.Headers)
+		}
+		s.opts.Sanitizer.Sanitize(t)
+		if err := payload.Offload(ctx, s.opts.Blobs, t); err != nil {
+			s.logger.WarnContext(ctx, fmt.Sprintf("store bodies of capture %s: %v", t.ID, err))
+			t.Request.Body.Data = nil
+			t.Response.Body.Data = nil
+		}
+	}
+
+	for start := 0; start < len(records); start += s.opts.BatchSize {
+		end := min(start+s.opts.BatchSize, len(records))
+		if err := s.repo.SaveCapturedTrafficBatch(ctx, records[start:end]); err != nil {
+			return fmt.Errorf("save records %d-%d: %w", start, end-1, err)
+		}
+	}
+	return nil
+}
+
+func countSessions(records []traffic.CapturedTraffic) int {
+	seen := make(map[traffic.SessionID]struct{})
+	for _, t := range records {
+		seen[t.SessionID] = struct{}{}
+	}
+	return len(seen)
+}
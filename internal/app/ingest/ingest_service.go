@@ -0,0 +1,181 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"synthema/internal/domain/traffic"
+	"synthema/internal/observability"
+	"synthema/internal/ports/queue"
+	"synthema/internal/ports/repository"
+)
+
+const (
+	defaultConcurrency   = 4
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+	defaultFlushTimeout  = 30 * time.Second
+	minReadBlock         = 10 * time.Millisecond
+	readErrorBackoff     = time.Second
+)
+
+type Options struct {
+	Concurrency   int
+	BatchSize     int
+	FlushInterval time.Duration
+	// FlushTimeout bounds a single batch write, including the final drain
+	// on shutdown.
+	FlushTimeout time.Duration
+	// SessionIdleTimeout closes traffic sessions that have not seen a
+	// request for this long. Zero disables the reaper.
+	SessionIdleTimeout time.Duration
+}
+
+// Service drains captured traffic from the queue into the traffic
+// repository. Each of Concurrency loops accumulates up to BatchSize
+// deliveries or FlushInterval worth of traffic, writes them in one batch
+// and acknowledges them only once they are stored.
+type Service struct {
+	logger *observability.Logger
+
+	consumer queue.TrafficConsumer
+	repo     repository.TrafficRepository
+	opts     Options
+}
+
+func NewService(logger *observability.Logger, consumer queue.TrafficConsumer, repo repository.TrafficRepository, opts Options) *Service {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.FlushTimeout <= 0 {
+		opts.FlushTimeout = defaultFlushTimeout
+	}
+	return &Service{logger: logger, consumer: consumer, repo: repo, opts: opts}
+}
+
+// Run blocks until ctx is canceled and every loop has flushed the batch it
+// was holding.
+func (s *Service) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	if s.opts.SessionIdleTimeout > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.reapSessions(ctx)
+		}()
+	}
+	for i := 0; i < s.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *Service) loop(ctx context.Context) {
+	batch := make([]queue.Delivery, 0, s.opts.BatchSize)
+	deadline := time.Now().Add(s.opts.FlushInterval)
+
+	for {
+		if ctx.Err() != nil {
+			s.flush(ctx, batch)
+			return
+		}
+
+		block := max(time.Until(deadline), minReadBlock)
+		deliveries, err := s.consumer.ReadCapturedTraffic(ctx, s.opts.BatchSize-len(batch), block)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			s.logger.ErrorContext(ctx, fmt.Sprintf("read captured traffic: %v", err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(readErrorBackoff):
+			}
+			continue
+		}
+		batch = append(batch, deliveries...)
+
+		if len(batch) >= s.opts.BatchSize || !time.Now().Before(deadline) {
+			s.flush(ctx, batch)
+			batch = batch[:0]
+			deadline = time.Now().Add(s.opts.FlushInterval)
+		}
+	}
+}
+
+// flush stores the batch and acknowledges what was stored. The write is
+// detached from ctx so a shutdown signal does not abort a batch halfway.
+func (s *Service) flush(ctx context.Context, batch []queue.Delivery) {
+	if len(batch) == 0 {
+		return
+	}
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.opts.FlushTimeout)
+	defer cancel()
+
+	records := make([]traffic.CapturedTraffic, len(batch))
+	ids := make([]string, len(batch))
+	for i, d := range batch {
+		records[i] = d.Traffic
+		ids[i] = d.ID
+	}
+
+	if err := s.repo.SaveCapturedTrafficBatch(flushCtx, records); err != nil {
+		s.logger.WarnContext(ctx, fmt.Sprintf("save batch of %d captured requests: %v; retrying one by one", len(batch), err))
+		ids = s.saveIndividually(flushCtx, batch)
+	}
+
+	if err := s.consumer.AckCapturedTraffic(flushCtx, ids...); err != nil {
+		s.logger.ErrorContext(ctx, fmt.Sprintf("ack %d captured requests: %v", len(ids), err))
+	}
+}
+
+// saveIndividually isolates records that make a batch fail. Failed records
+// stay unacknowledged so the queue redelivers and eventually dead-letters
+// them.
+func (s *Service) saveIndividually(ctx context.Context, batch []queue.Delivery) []string {
+	stored := make([]string, 0, len(batch))
+	for _, d := range batch {
+		if err := s.repo.SaveCapturedTraffic(ctx, d.Traffic); err != nil {
+			s.logger.ErrorContext(ctx, fmt.Sprintf("save captured request %s: %v", d.Traffic.ID, err))
+			continue
+		}
+		stored = append(stored, d.ID)
+	}
+	return stored
+}
+
+// reapSessions periodically closes idle traffic sessions. The update is
+// idempotent, so every worker replica can run it.
+func (s *Service) reapSessions(ctx context.Context) {
+	ticker := time.NewTicker(min(s.opts.SessionIdleTimeout/2, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			closed, err := s.repo.CloseIdleSessions(ctx, now.Add(-s.opts.SessionIdleTimeout))
+			if err != nil {
+				s.logger.ErrorContext(ctx, fmt.Sprintf("close idle traffic sessions: %v", err))
+				continue
+			}
+			if closed > 0 {
+				s.logger.InfoContext(ctx, fmt.Sprintf("closed %d idle traffic sessions", closed))
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package payload
+
+import (
+	"context"
+
+	"synthema/internal/domain/traffic"
+	"synthema/internal/ports/blob"
+)
+
+// Offload moves inline request, response and WebSocket frame bodies into
+// the blob store and leaves a reference behind. Blobs are keyed by the
+// SHA-256 of the stored bytes, so identical payloads are stored once.
+func Offload(ctx context.Context, store blob.Store, t *traffic.CapturedTraffic) error {
+	if store == nil {
+		return nil
+	}
+	if err := offloadBody(ctx, store, &t.Request.Body); err != nil {
+		return err
+	}
+	if err := offloadBody(ctx, store, &t.Response.Body); err != nil {
+		return err
+	}
+	for i := range t.Frames {
+		if err := offloadBody(ctx, store, &t.Frames[i].Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func offloadBody(ctx context.Context, store blob.Store, b *traffic.Body) error {
+	if len(b.Data) == 0 || b.Ref != "" {
+		return nil
+	}
+	key := traffic.HashBody(b.Data)
+	if err := store.Put(ctx, key, b.Data); err != nil {
+		return err
+	}
+	b.Ref = key
+	b.Data = nil
+	return nil
+}
+
+// Complete reports whether Load returns every byte of the captured body:
+// it was not cut at the capture limit, and an offloaded body can be read
+// from store.
+func Complete(store blob.Store, b traffic.Body) bool {
+	switch {
+	case b.Truncated:
+		return false
+	case len(b.Data) > 0:
+		return true
+	case b.Ref != "":
+		return store != nil
+	default:
+		return b.Size == 0
+	}
+}
+
+// Load returns the stored bytes of a body, reading them from the blob
+// store when the body was offloaded.
+func Load(ctx context.Context, store blob.Store, b traffic.Body) ([]byte, error) {
+	if len(b.Data) > 0 || b.Ref == "" || store == nil {
+		return b.Data, nil
+	}
+	return store.Get(ctx, b.Ref)
+}
@@ -0,0 +1,130 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"synthema/internal/domain/traffic"
+)
+
+// Redacted replaces the value of every scrubbed header.
+const Redacted = "[REDACTED]"
+
+// DefaultScrubHeaders are always scrubbed from captured traffic: credentials,
+// and the headers proxies put the client IP in, which would otherwise keep
+// the IP that ClientIPHash replaces.
+var DefaultScrubHeaders = []string{
+	"Authorization", "Cookie", "Set-Cookie",
+	"X-Forwarded-For", "X-Real-IP", "Forwarded", "True-Client-IP", "CF-Connecting-IP",
+}
+
+// HashKey is the HMAC key. Its ID is stored with every hash. Rotation is a
+// cut-over: hashes made under a retired key can be told apart by their ID
+// but not recomputed, so a client is not linked across the change.
+type HashKey struct {
+	ID     string
+	Secret string
+}
+
+// ParseHashKey reads a spec such as "2024b:secret". Only the active key is
+// given; retired secrets are not kept.
+func ParseHashKey(spec string) (HashKey, bool, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return HashKey{}, false, nil
+	}
+	if strings.Contains(spec, ",") {
+		return HashKey{}, false, errors.New("hash key spec names several keys; give only the active id:secret")
+	}
+	id, secret, ok := strings.Cut(spec, ":")
+	if !ok || strings.TrimSpace(id) == "" || secret == "" {
+		return HashKey{}, false, fmt.Errorf("hash key %q must be id:secret", redactSpec(spec))
+	}
+	return HashKey{ID: strings.TrimSpace(id), Secret: secret}, true, nil
+}
+
+func redactSpec(item string) string {
+	id, _, _ := strings.Cut(item, ":")
+	return id + ":***"
+}
+
+// Hasher pseudonymises values such as client IPs with keyed HMAC-SHA256.
+type Hasher struct {
+	key HashKey
+}
+
+func NewHasher(key HashKey) (*Hasher, error) {
+	if key.ID == "" || key.Secret == "" {
+		return nil, errors.New("hasher requires a key id and secret")
+	}
+	if strings.Contains(key.ID, ":") {
+		return nil, fmt.Errorf("hash key id %q must not contain ':'", key.ID)
+	}
+	return &Hasher{key: key}, nil
+}
+
+// Hash returns "<key id>:<hex digest>", or "" for an empty value.
+func (h *Hasher) Hash(v string) string {
+	if v == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(h.key.Secret))
+	mac.Write([]byte(v))
+	return h.key.ID + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ScrubHeaders returns a copy of h with the values of the named headers
+// replaced by Redacted. The header names themselves are kept so replays
+// know a credential was present.
+func ScrubHeaders(h http.Header, names []string) http.Header {
+	if h == nil {
+		return nil
+	}
+	out := h.Clone()
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if values, ok := out[name]; ok {
+			scrubbed := make([]string, len(values))
+			for i := range scrubbed {
+				scrubbed[i] = Redacted
+			}
+			out[name] = scrubbed
+		}
+	}
+	return out
+}
+
+// Sanitizer strips personal data from a record before it leaves the
+// process: credentials and client IP headers are redacted and the client IP
+// and external session key are replaced by keyed hashes. Without a hasher both
+// are discarded.
+type Sanitizer struct {
+	hasher *Hasher
+	scrub  []string
+}
+
+// NewSanitizer scrubs DefaultScrubHeaders plus any extra headers given.
+func NewSanitizer(hasher *Hasher, scrubHeaders []string) *Sanitizer {
+	return &Sanitizer{
+		hasher: hasher,
+		scrub:  append(append([]string(nil), DefaultScrubHeaders...), scrubHeaders...),
+	}
+}
+
+func (s *Sanitizer) Sanitize(t *traffic.CapturedTraffic) {
+	t.Request.Headers = ScrubHeaders(t.Request.Headers, s.scrub)
+	t.Response.Headers = ScrubHeaders(t.Response.Headers, s.scrub)
+	if s.hasher != nil {
+		t.ClientIPHash = s.hasher.Hash(t.ClientIP)
+		t.ExternalSessionKey = s.hasher.Hash(t.ExternalSessionKey)
+	} else {
+		t.ClientIPHash = ""
+		t.ExternalSessionKey = ""
+	}
+	t.ClientIP = ""
+}
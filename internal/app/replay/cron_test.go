@@ -0,0 +1,42 @@
+package replay
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronDayFields(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	for _, tc := range []struct {
+		cron string
+		day  string
+		want bool
+	}{
+		// Both restricted: either day field fires.
+		{"0 0 1 * 1", "2026-10-01", true}, // Thursday, first of the month
+		{"0 0 1 * 1", "2026-10-05", true}, // Monday
+		{"0 0 1 * 1", "2026-10-06", false},
+		// A step on "*" leaves day-of-month unrestricted, so only Mondays
+		// that fall on an odd day fire.
+		{"0 0 */2 * 1", "2026-10-05", true},
+		{"0 0 */2 * 1", "2026-10-12", false},
+		{"0 0 */2 * 1", "2026-10-03", false}, // Saturday
+		{"0 0 1 * */2", "2026-10-01", true},  // Thursday
+		{"0 0 1 * */2", "2027-01-01", false}, // Friday
+		{"0 0 1 * */2", "2026-10-06", false},
+	} {
+		spec, err := parseCron(tc.cron)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := spec.matches(day(tc.day)); got != tc.want {
+			t.Errorf("%q on %s = %v, want %v", tc.cron, tc.day, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package replay
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"synthema/internal/app/payload"
+	"synthema/internal/domain/replay"
+	"synthema/internal/domain/traffic"
+	"synthema/internal/ports/blob"
+	"synthema/pkg/pathmatch"
+)
+
+// Error classes of requests the guard keeps from the target.
+const (
+	classHostNotAllowed  = "host_not_allowed"
+	classMutationSkipped = "mutation_skipped"
+	classDryRun          = "dry_run"
+	// classBodyUnavailable marks requests whose body was not kept in full;
+	// sending what is left would corrupt them.
+	classBodyUnavailable = "body_unavailable"
+)
+
+func validateMutationPolicy(p replay.Policy) error {
+	switch p.Mutations {
+	case "", replay.MutationsSkip, replay.MutationsDryRun, replay.MutationsAllow:
+		return nil
+	default:
+		return fmt.Errorf("mutation policy %q", p.Mutations)
+	}
+}
+
+// blocked is why the guard keeps a request from the target.
+type blocked struct {
+	class   string
+	message string
+}
+
+// guard decides whether t may be sent to base. Requests to hosts off the
+// sender's allowlist are always blocked, and so are requests whose body
+// cannot be loaded in full; mutating requests as the shadow target's policy
+// says. A dry run reports the URL with the session's values substituted.
+func (s *Service) guard(run *taskRun, t traffic.CapturedTraffic, st *sessionState) *blocked {
+	for _, base := range append([]*url.URL{run.base}, run.baselines...) {
+		if err := s.opts.Sender.Allowed(base); err != nil {
+			return &blocked{class: classHostNotAllowed, message: err.Error()}
+		}
+	}
+	if b := s.bodyUnavailable(t); b != nil {
+		return b
+	}
+	if !mutating(run.target.Policy, t) {
+		return nil
+	}
+	switch run.target.Policy.Mutations {
+	case replay.MutationsAllow:
+		return nil
+	case replay.MutationsDryRun:
+		if sess := st.of(run.base); sess != nil {
+			t, _ = sess.Apply(t, nil)
+		}
+		u := targetURL(run.base, t)
+		return &blocked{class: classDryRun, message: fmt.Sprintf("dry run: %s %s", t.Method, u.String())}
+	default:
+		return &blocked{class: classMutationSkipped, message: fmt.Sprintf("%s %s not replayed: shadow target %s skips mutating requests", t.Method, t.Request.Path, run.target.ID)}
+	}
+}
+
+func (s *Service) bodyUnavailable(t traffic.CapturedTraffic) *blocked {
+	if !payload.Complete(s.opts.Blobs, t.Request.Body) {
+		return &blocked{class: classBodyUnavailable, message: fmt.Sprintf("%s %s not replayed: %s", t.Method, t.Request.Path, unavailable(s.opts.Blobs, t.Request.Body))}
+	}
+	for i, f := range t.Frames {
+		if f.Direction == traffic.FrameFromClient && !payload.Complete(s.opts.Blobs, f.Body) {
+			return &blocked{class: classBodyUnavailable, message: fmt.Sprintf("websocket %s not replayed: frame %d %s", t.Request.Path, i, unavailable(s.opts.Blobs, f.Body))}
+		}
+	}
+	return nil
+}
+
+func unavailable(store blob.Store, b traffic.Body) string {
+	switch {
+	case b.Truncated:
+		return fmt.Sprintf("body of %d bytes was truncated at capture", b.Size)
+	case b.Ref != "" && store == nil:
+		return "body is in the blob store, which replay has not configured"
+	default:
+		return fmt.Sprintf("body of %d bytes was not stored", b.Size)
+	}
+}
+
+// mutating reports whether t may change state on the target.
+func mutating(p replay.Policy, t traffic.CapturedTraffic) bool {
+	switch strings.ToUpper(t.Method) {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return false
+	}
+	for _, pattern := range p.ReadOnlyPaths {
+		if pathmatch.Match(pattern, t.Request.Path) {
+			return false
+		}
+	}
+	return true
+}
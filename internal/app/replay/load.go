@@ -0,0 +1,190 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"synthema/internal/domain/common"
+	"synthema/internal/domain/replay"
+	"synthema/internal/domain/traffic"
+)
+
+// defaultLoadInFlight caps the requests a load job has outstanding when
+// its params set no MaxInFlight.
+const defaultLoadInFlight = 64
+
+// validateMode checks the mode of a job's params and, for load jobs, the
+// load profile.
+func validateMode(p replay.JobParams) error {
+	switch p.Mode {
+	case "", replay.ModeShadow:
+		if p.Load != nil {
+			return fmt.Errorf("%w: load params need mode %q", common.ErrInvalidInput, replay.ModeLoad)
+		}
+		return nil
+	case replay.ModeLoad:
+	default:
+		return fmt.Errorf("%w: mode %q", common.ErrInvalidInput, p.Mode)
+	}
+	if p.Load == nil || p.Load.TargetRPS <= 0 || p.Load.DurationSeconds <= 0 {
+		return fmt.Errorf("%w: mode %q needs a positive target rps and duration", common.ErrInvalidInput, p.Mode)
+	}
+	if p.Load.RampUpSeconds < 0 || p.Load.RampUpSeconds > p.Load.DurationSeconds {
+		return fmt.Errorf("%w: ramp up must be between zero and the duration", common.ErrInvalidInput)
+	}
+	if p.Speed != "" || p.TaskType != "" {
+		return fmt.Errorf("%w: mode %q sets its own speed and tasks", common.ErrInvalidInput, p.Mode)
+	}
+	return nil
+}
+
+// runLoad replays the requests of the task's sessions in a loop, in
+// sequence order, at the job's request rate. WebSocket connections are left
+// out, transform rules are not applied and a three-way target's baselines
+// get no load. Requests the guard would block are left out too; a target
+// off the allowlist fails the run. Nothing is diffed; the job gets a
+// summary of latencies, status codes and errors instead. When MaxInFlight
+// requests are outstanding, sending waits and the rate falls behind the
+// target.
+func (s *Service) runLoad(ctx context.Context, run *taskRun) error {
+	if err := s.opts.Sender.Allowed(run.base); err != nil {
+		return err
+	}
+	var records []traffic.CapturedTraffic
+	for _, sessionID := range run.task.SessionIDs {
+		session, err := s.traffic.ListSessionRequests(ctx, sessionID)
+		if err != nil {
+			return fmt.Errorf("load session %s: %w", sessionID, err)
+		}
+		for _, t := range session {
+			if t.Protocol != traffic.ProtocolWebSocket && s.guard(run, t, nil) == nil {
+				records = append(records, t)
+			}
+		}
+	}
+	if len(records) == 0 {
+		return errors.New("no requests to replay")
+	}
+
+	load := run.params.Load
+	ramp := time.Duration(load.RampUpSeconds) * time.Second
+	inFlight := run.params.MaxInFlight
+	if inFlight <= 0 {
+		inFlight = defaultLoadInFlight
+	}
+	rec := newLoadRecorder()
+	slots := make(chan struct{}, inFlight)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	end := start.Add(time.Duration(load.DurationSeconds) * time.Second)
+	for i := 0; ; i++ {
+		at := start.Add(loadOffset(i, load.TargetRPS, ramp))
+		if !at.Before(end) {
+			break
+		}
+		if err := sleep(ctx, time.Until(at)); err != nil {
+			break
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		t := records[i%len(records)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			out, err := s.send(ctx, run.base, t, nil)
+			rec.add(out, err)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	summary := rec.summary(time.Since(start))
+	if err := s.repo.SaveJobSummary(ctx, run.task.JobID, summary); err != nil {
+		return fmt.Errorf("save job summary: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("replay job %s sent %d requests at %.1f rps, p99 %.1fms", run.task.JobID, summary.Requests, summary.AchievedRPS, summary.LatencyMS.P99))
+	return nil
+}
+
+// loadOffset is when the i-th request of a load run is due. The rate climbs
+// linearly from zero to rps over ramp, so i requests are due after
+// sqrt(2·ramp·i/rps) during the ramp and after i/rps + ramp/2 past it.
+func loadOffset(i int, rps float64, ramp time.Duration) time.Duration {
+	n, r := float64(i), ramp.Seconds()
+	if r > 0 && n < rps*r/2 {
+		return time.Duration(math.Sqrt(2*r*n/rps) * float64(time.Second))
+	}
+	return time.Duration((n/rps + r/2) * float64(time.Second))
+}
+
+// loadRecorder collects the outcomes of a load run.
+type loadRecorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	sum       replay.JobSummary
+}
+
+func newLoadRecorder() *loadRecorder {
+	return &loadRecorder{sum: replay.JobSummary{
+		ErrorClasses: make(map[string]int),
+		StatusCodes:  make(map[string]int),
+	}}
+}
+
+func (r *loadRecorder) add(out Outcome, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sum.Requests++
+	if err != nil {
+		r.sum.Errors++
+		r.sum.ErrorClasses[errorClass(err)]++
+		return
+	}
+	r.sum.StatusCodes[strconv.Itoa(out.Response.StatusCode)]++
+	r.latencies = append(r.latencies, out.Latency)
+}
+
+func (r *loadRecorder) summary(elapsed time.Duration) replay.JobSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sum := r.sum
+	sum.DurationMS = elapsed.Milliseconds()
+	if elapsed > 0 {
+		sum.AchievedRPS = float64(sum.Requests) / elapsed.Seconds()
+	}
+	slices.Sort(r.latencies)
+	sum.LatencyMS = replay.Percentiles{
+		P50: percentile(r.latencies, 50),
+		P90: percentile(r.latencies, 90),
+		P95: percentile(r.latencies, 95),
+		P99: percentile(r.latencies, 99),
+		Max: percentile(r.latencies, 100),
+	}
+	return sum
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies, in
+// milliseconds.
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	rank = min(max(rank, 1), len(sorted))
+	return float64(sorted[rank-1]) / float64(time.Millisecond)
+}
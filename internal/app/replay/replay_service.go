@@ -2,22 +2,946 @@ package replay
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/google/uuid"
+
+	appdiff "synthema/internal/app/diff"
+	"synthema/internal/app/payload"
+	apptransform "synthema/internal/app/transform"
+	"synthema/internal/domain/common"
+	"synthema/internal/domain/diff"
+	"synthema/internal/domain/replay"
+	"synthema/internal/domain/traffic"
+	"synthema/internal/domain/transform"
 	"synthema/internal/observability"
+	"synthema/internal/ports/blob"
 	"synthema/internal/ports/repository"
 )
 
+const (
+	defaultConcurrency  = 4
+	defaultPollInterval = 2 * time.Second
+	defaultBatchSize    = 50
+	defaultLease        = 30 * time.Second
+	defaultMaxAttempts  = 3
+	// Schedules are checked every scheduleInterval, and a run is started
+	// up to defaultScheduleGrace late.
+	scheduleInterval     = 30 * time.Second
+	defaultScheduleGrace = time.Hour
+	// finishTimeout bounds the status writes made after ctx is cancelled.
+	finishTimeout = 5 * time.Second
+)
+
+// Causes a running task is cancelled with when its job changes status.
+var (
+	errJobPaused   = errors.New("job paused")
+	errJobCanceled = errors.New("job canceled")
+)
+
+// Service runs replay jobs. It plans queued jobs into tasks, one per
+// session or per batch of sessions, then claims tasks and replays their
+// requests against the shadow target's environment. Every request yields
+// a replay_results row and a diff_results row.
+//
+// Several workers may run jobs at once. A claimed task is leased to one
+// worker, which renews the lease while it replays; when a worker dies its
+// tasks are queued again once the lease expires, until they run out of
+// attempts.
 type Service struct {
 	logger *observability.Logger
 
-	repo repository.ReplayRepository
+	repo    repository.ReplayRepository
+	traffic repository.TrafficRepository
+	diffs   repository.DiffRepository
+
+	opts Options
+
+	// noise holds the noise models of the three-way jobs this worker runs
+	// tasks of; see jobNoise.
+	noiseMu sync.Mutex
+	noise   map[replay.ReplayID]*appdiff.Noise
+}
+
+type Options struct {
+	// Concurrency is the number of tasks replayed at once.
+	Concurrency  int
+	PollInterval time.Duration
+	// WorkerID names this worker as the owner of the tasks it claims. It
+	// must differ between workers.
+	WorkerID string
+	// Lease is how long a claimed task stays with this worker without a
+	// renewal. It is renewed every third of that.
+	Lease time.Duration
+	// MaxAttempts is how many times a task is claimed before a lost lease
+	// fails it, unless its shadow target's retry policy sets a limit.
+	MaxAttempts int
+	// ScheduleGrace is how late a shadow target schedule's run may still
+	// start a job.
+	ScheduleGrace time.Duration
+	// Sender and Comparer are only needed to run jobs, not to create them.
+	Sender   *Sender
+	Comparer *appdiff.Comparer
+	// Blobs holds offloaded request and response bodies.
+	Blobs blob.Store
+	// Fingerprinter labels diff results with their endpoint.
+	Fingerprinter *traffic.Fingerprinter
+	// Transforms loads the rule sets jobs name; without it such jobs are
+	// refused.
+	Transforms *apptransform.Engine
+}
+
+func NewService(logger *observability.Logger, repo repository.ReplayRepository, trafficRepo repository.TrafficRepository, diffs repository.DiffRepository, opts Options) *Service {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.WorkerID == "" {
+		opts.WorkerID = uuid.NewString()
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = defaultLease
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.ScheduleGrace <= 0 {
+		opts.ScheduleGrace = defaultScheduleGrace
+	}
+	if opts.Comparer == nil {
+		opts.Comparer = appdiff.NewComparer(nil)
+	}
+	return &Service{logger: logger, repo: repo, traffic: trafficRepo, diffs: diffs, opts: opts, noise: make(map[replay.ReplayID]*appdiff.Noise)}
+}
+
+// CreateJob queues a replay of the sessions params selects against a shadow
+// target. The transform rule set, if given, must be an active one of the
+// target's project.
+func (s *Service) CreateJob(ctx context.Context, shadowTargetID, transformRuleSetID string, params replay.JobParams) (replay.ReplayJob, error) {
+	if err := validateParams(params); err != nil {
+		return replay.ReplayJob{}, err
+	}
+	target, err := s.repo.GetShadowTarget(ctx, shadowTargetID)
+	if err != nil {
+		return replay.ReplayJob{}, err
+	}
+	job, err := s.newJob(ctx, target, transformRuleSetID, params)
+	if err != nil {
+		return replay.ReplayJob{}, err
+	}
+	if err := s.repo.SaveReplayJob(ctx, job); err != nil {
+		return replay.ReplayJob{}, err
+	}
+	return job, nil
+}
+
+func validateParams(params replay.JobParams) error {
+	switch params.TaskType {
+	case "", replay.TaskSession, replay.TaskBatch:
+	default:
+		return fmt.Errorf("%w: task type %q", common.ErrInvalidInput, params.TaskType)
+	}
+	if params.Limit < 0 || params.BatchSize < 0 {
+		return fmt.Errorf("%w: limit and batch size must not be negative", common.ErrInvalidInput)
+	}
+	if err := validateSpeed(params); err != nil {
+		return err
+	}
+	if err := validateMode(params); err != nil {
+		return err
+	}
+	if params.From != nil && params.To != nil && !params.From.Before(*params.To) {
+		return fmt.Errorf("%w: from must be before to", common.ErrInvalidInput)
+	}
+	return nil
+}
+
+// newJob builds a queued job after checking that target can run it.
+func (s *Service) newJob(ctx context.Context, target replay.ShadowTarget, transformRuleSetID string, params replay.JobParams) (replay.ReplayJob, error) {
+	if target.Status != "active" {
+		return replay.ReplayJob{}, fmt.Errorf("%w: shadow target %s is %s", common.ErrInvalidInput, target.ID, target.Status)
+	}
+	if err := validateMutationPolicy(target.Policy); err != nil {
+		return replay.ReplayJob{}, fmt.Errorf("%w: shadow target %s: %v", common.ErrInvalidInput, target.ID, err)
+	}
+	if err := validateRetryPolicy(target.Retry); err != nil {
+		return replay.ReplayJob{}, fmt.Errorf("%w: shadow target %s: %v", common.ErrInvalidInput, target.ID, err)
+	}
+	if transformRuleSetID != "" {
+		if err := s.checkRuleSet(ctx, target, transform.RuleSetID(transformRuleSetID)); err != nil {
+			return replay.ReplayJob{}, err
+		}
+	}
+
+	now := time.Now().UTC()
+	return replay.ReplayJob{
+		ID:                 replay.ReplayID(uuid.NewString()),
+		ProjectID:          target.ProjectID,
+		ShadowTargetID:     target.ID,
+		TransformRuleSetID: transformRuleSetID,
+		Status:             replay.StatusQueued,
+		Params:             params,
+		CreatedAt:          now,
+		RequestedAt:        now,
+	}, nil
+}
+
+func (s *Service) checkRuleSet(ctx context.Context, target replay.ShadowTarget, id transform.RuleSetID) error {
+	if s.opts.Transforms == nil {
+		return errors.New("replay service has no transform engine configured")
+	}
+	rs, err := s.opts.Transforms.RuleSet(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rs.ProjectID != target.ProjectID {
+		return fmt.Errorf("%w: transform rule set %s belongs to another project", common.ErrInvalidInput, id)
+	}
+	if rs.Status != "active" {
+		return fmt.Errorf("%w: transform rule set %s is %s", common.ErrInvalidInput, id, rs.Status)
+	}
+	if _, err := s.opts.Transforms.Compile(rs); err != nil {
+		return fmt.Errorf("%w: %v", common.ErrInvalidInput, err)
+	}
+	return nil
+}
+
+// rules loads and compiles the job's transform rule set; nil when it has
+// none.
+func (s *Service) rules(ctx context.Context, job replay.ReplayJob) (*apptransform.Rules, error) {
+	if job.TransformRuleSetID == "" {
+		return nil, nil
+	}
+	if s.opts.Transforms == nil {
+		return nil, errors.New("replay service has no transform engine configured")
+	}
+	rs, err := s.opts.Transforms.RuleSet(ctx, transform.RuleSetID(job.TransformRuleSetID))
+	if err != nil {
+		return nil, err
+	}
+	return s.opts.Transforms.Compile(rs)
 }
 
-func NewService(logger *observability.Logger, repo repository.ReplayRepository) *Service {
-	return &Service{logger: logger, repo: repo}
+// Attempts returns how each recorded attempt at the job's tasks ended.
+func (s *Service) Attempts(ctx context.Context, id replay.ReplayID) ([]replay.TaskAttempt, error) {
+	if _, err := s.repo.GetReplayJob(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListAttempts(ctx, id)
 }
 
+// CancelJob stops a job for good. Its queued tasks are canceled at once;
+// running ones once their workers next renew their leases.
+func (s *Service) CancelJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error) {
+	job, err := s.repo.CancelJob(ctx, id)
+	if err != nil {
+		return replay.ReplayJob{}, err
+	}
+	s.logger.Info(fmt.Sprintf("replay job %s canceled", id))
+	return job, nil
+}
+
+// PauseJob stops a job from handing out tasks. Running tasks are queued
+// again once their workers next renew their leases; on resume they carry
+// on after the last request they replayed.
+func (s *Service) PauseJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error) {
+	job, err := s.repo.PauseJob(ctx, id)
+	if err != nil {
+		return replay.ReplayJob{}, err
+	}
+	s.logger.Info(fmt.Sprintf("replay job %s paused", id))
+	return job, nil
+}
+
+// ResumeJob continues a paused job with the tasks it has not finished.
+func (s *Service) ResumeJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error) {
+	job, err := s.repo.ResumeJob(ctx, id)
+	if err != nil {
+		return replay.ReplayJob{}, err
+	}
+	s.logger.Info(fmt.Sprintf("replay job %s resumed", id))
+	if job.Status == replay.StatusRunning {
+		// Its last tasks may have finished while it was paused.
+		s.finishJob(ctx, id)
+		if job, err = s.repo.GetReplayJob(ctx, id); err != nil {
+			return replay.ReplayJob{}, err
+		}
+	}
+	return job, nil
+}
+
+// Job returns a job with its tasks counted by status.
+func (s *Service) Job(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, replay.TaskCounts, error) {
+	job, err := s.repo.GetReplayJob(ctx, id)
+	if err != nil {
+		return replay.ReplayJob{}, nil, err
+	}
+	counts, err := s.repo.CountTasks(ctx, id)
+	if err != nil {
+		return replay.ReplayJob{}, nil, err
+	}
+	return job, counts, nil
+}
+
+// Run starts the jobs of shadow target schedules, then plans and replays
+// jobs until ctx is cancelled. Tasks interrupted by shutdown are queued
+// again without using up an attempt.
 func (s *Service) Run(ctx context.Context) error {
-	<-ctx.Done()
+	if s.opts.Sender == nil {
+		return errors.New("replay service has no sender configured")
+	}
+	if !s.opts.Sender.AllowsAny() {
+		s.logger.Warn(fmt.Sprintf("replay allowlist is empty; every request is skipped as %s", classHostNotAllowed))
+	}
+	slots := make(chan struct{}, s.opts.Concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+
+	var nextSchedules time.Time
+	for {
+		if now := time.Now(); !now.Before(nextSchedules) {
+			s.startScheduled(ctx, now)
+			s.pruneNoise(ctx)
+			nextSchedules = now.Add(scheduleInterval)
+		}
+		s.requeueExpired(ctx)
+		s.planJobs(ctx)
+	claim:
+		for ctx.Err() == nil {
+			select {
+			case slots <- struct{}{}:
+			default:
+				break claim
+			}
+			task, ok, err := s.repo.ClaimTask(ctx, s.opts.WorkerID, s.opts.Lease)
+			if err != nil || !ok {
+				<-slots
+				if err != nil && ctx.Err() == nil {
+					s.logger.Error(fmt.Sprintf("claim replay task: %v", err))
+				}
+				break
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				s.runTask(ctx, task)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// requeueExpired takes back the tasks of workers that stopped renewing
+// their leases. A job whose last task failed that way is finished here, as
+// no worker is left to do it.
+func (s *Service) requeueExpired(ctx context.Context) {
+	tasks, err := s.repo.RequeueExpired(ctx, s.opts.MaxAttempts)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Error(fmt.Sprintf("requeue expired replay tasks: %v", err))
+		}
+		return
+	}
+	for _, t := range tasks {
+		if t.Status == replay.StatusFailed {
+			s.logger.Warn(fmt.Sprintf("replay task %s failed: lease expired on its last attempt", t.ID))
+			s.finishJob(ctx, t.JobID)
+			continue
+		}
+		s.logger.Warn(fmt.Sprintf("replay task %s queued again: lease expired", t.ID))
+	}
+}
+
+func (s *Service) planJobs(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, ok, err := s.repo.PlanQueuedJob(ctx, func(job replay.ReplayJob) ([]replay.Task, error) {
+			return s.plan(ctx, job)
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				s.logger.Error(fmt.Sprintf("plan replay job: %v", err))
+			}
+			return
+		}
+		if !ok {
+			return
+		}
+		if job.Status == replay.StatusFailed {
+			s.logger.Warn(fmt.Sprintf("replay job %s failed to plan: %s", job.ID, job.ErrorMessage))
+			continue
+		}
+		s.logger.Info(fmt.Sprintf("replay job %s started", job.ID))
+		// A job without sessions has nothing to wait for.
+		s.finishJob(ctx, job.ID)
+	}
+}
+
+// plan splits a job into tasks.
+func (s *Service) plan(ctx context.Context, job replay.ReplayJob) ([]replay.Task, error) {
+	target, err := s.repo.GetShadowTarget(ctx, job.ShadowTargetID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := baseURL(target); err != nil {
+		return nil, err
+	}
+	if target.ReplayStrategy == replay.StrategyThreeWay && job.Params.Mode != replay.ModeLoad {
+		if _, err := baselineURLs(target); err != nil {
+			return nil, err
+		}
+	}
+	sessions, err := s.repo.SelectSessions(ctx, target.SourceEnvironmentID, job.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Params.Mode == replay.ModeLoad {
+		if len(sessions) == 0 {
+			return nil, nil
+		}
+		// One worker drives the whole request rate.
+		return []replay.Task{{
+			ID:         replay.TaskID(uuid.NewString()),
+			JobID:      job.ID,
+			Type:       replay.TaskLoad,
+			SessionIDs: sessions,
+			BatchKey:   "load",
+			Status:     replay.StatusQueued,
+		}}, nil
+	}
+
+	var tasks []replay.Task
+	if job.Params.TaskType != replay.TaskBatch {
+		for _, id := range sessions {
+			tasks = append(tasks, replay.Task{
+				ID:         replay.TaskID(uuid.NewString()),
+				JobID:      job.ID,
+				Type:       replay.TaskSession,
+				SessionIDs: []traffic.SessionID{id},
+				Status:     replay.StatusQueued,
+			})
+		}
+		return tasks, nil
+	}
+
+	size := job.Params.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	for start := 0; start < len(sessions); start += size {
+		tasks = append(tasks, replay.Task{
+			ID:         replay.TaskID(uuid.NewString()),
+			JobID:      job.ID,
+			Type:       replay.TaskBatch,
+			SessionIDs: sessions[start:min(start+size, len(sessions))],
+			BatchKey:   fmt.Sprintf("batch-%04d", start/size),
+			Status:     replay.StatusQueued,
+		})
+	}
+	return tasks, nil
+}
+
+func baseURL(target replay.ShadowTarget) (*url.URL, error) {
+	if target.TargetURL == "" {
+		return nil, fmt.Errorf("target environment %s has no base_url in its metadata", target.TargetEnvironmentID)
+	}
+	u, err := url.Parse(target.TargetURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("target environment %s has an invalid base_url %q", target.TargetEnvironmentID, target.TargetURL)
+	}
+	return u, nil
+}
+
+func (s *Service) runTask(ctx context.Context, task replay.Task) {
+	taskCtx, cancelTask := context.WithCancelCause(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		s.renewLease(taskCtx, cancelTask, task)
+	}()
+	err := s.replayTask(taskCtx, task)
+	cancelTask(nil)
+	<-renewed
+
+	cause := context.Cause(taskCtx)
+	if errors.Is(cause, replay.ErrLeaseLost) {
+		// The task belongs to another attempt now; leave its row alone.
+		s.logger.Warn(fmt.Sprintf("replay task %s abandoned: %v", task.ID, replay.ErrLeaseLost))
+		return
+	}
+
+	finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finishTimeout)
+	defer cancel()
+	now := time.Now().UTC()
+	task.FinishedAt = &now
+	var retryErr *retryError
+	switch {
+	case ctx.Err() != nil, errors.Is(cause, errJobPaused):
+		// Shutdown or pause: leave the task for the next worker to pick up.
+		task.Status = replay.StatusQueued
+		task.FinishedAt = nil
+	case errors.Is(cause, errJobCanceled):
+		task.Status = replay.StatusCanceled
+		task.ErrorMessage = errJobCanceled.Error()
+	case errors.As(err, &retryErr):
+		at := now.Add(retryErr.after)
+		task.Status = replay.StatusQueued
+		task.ScheduledAt = &at
+		task.ErrorMessage = err.Error()
+		s.logger.Warn(fmt.Sprintf("replay task %s attempt %d failed, retrying in %s: %v", task.ID, task.Attempt, retryErr.after.Round(time.Millisecond), err))
+	case err != nil:
+		task.Status = replay.StatusFailed
+		task.ErrorMessage = err.Error()
+	default:
+		task.Status = replay.StatusSucceeded
+	}
+	if err := s.repo.FinishTask(finishCtx, task); err != nil {
+		if errors.Is(err, replay.ErrLeaseLost) {
+			s.logger.Warn(fmt.Sprintf("replay task %s finished after its lease expired; outcome dropped", task.ID))
+			return
+		}
+		s.logger.Error(fmt.Sprintf("finish replay task %s: %v", task.ID, err))
+		return
+	}
+	if task.Status.Done() {
+		s.finishJob(finishCtx, task.JobID)
+	}
+}
+
+// renewLease keeps the task's lease until ctx is done. It cancels the task
+// with replay.ErrLeaseLost once the lease is gone, and also when it cannot
+// be renewed before it expires, since another worker may then claim it.
+// When the task's job has been paused or canceled, it cancels the task with
+// errJobPaused or errJobCanceled, so a running task stops within a third
+// of its lease.
+func (s *Service) renewLease(ctx context.Context, cancel context.CancelCauseFunc, task replay.Task) {
+	ticker := time.NewTicker(s.opts.Lease / 3)
+	defer ticker.Stop()
+	expires := time.Now().Add(s.opts.Lease)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		status, err := s.repo.RenewLease(ctx, task.ID, s.opts.WorkerID, s.opts.Lease)
+		switch {
+		case err == nil:
+			expires = time.Now().Add(s.opts.Lease)
+			switch status {
+			case replay.StatusPaused:
+				cancel(errJobPaused)
+				return
+			case replay.StatusCanceled:
+				cancel(errJobCanceled)
+				return
+			}
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, replay.ErrLeaseLost):
+			cancel(replay.ErrLeaseLost)
+			return
+		default:
+			s.logger.Error(fmt.Sprintf("renew lease of replay task %s: %v", task.ID, err))
+			if time.Until(expires) < s.opts.Lease/3 {
+				cancel(replay.ErrLeaseLost)
+				return
+			}
+		}
+	}
+}
+
+func (s *Service) finishJob(ctx context.Context, id replay.ReplayID) {
+	status, done, err := s.repo.FinishJob(ctx, id)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("finish replay job %s: %v", id, err))
+		return
+	}
+	if done {
+		s.logger.Info(fmt.Sprintf("replay job %s %s", id, status))
+	}
+	if status.Done() {
+		s.dropNoise(id)
+	}
+}
+
+// taskRun is what the requests of one task share.
+type taskRun struct {
+	task   replay.Task
+	params replay.JobParams
+	target replay.ShadowTarget
+	base   *url.URL
+	// baselines and noise are set for three-way replays.
+	baselines []*url.URL
+	noise     *appdiff.Noise
+	// retryOn holds the error classes the target's retry policy names;
+	// nil when it allows no retries.
+	retryOn map[string]bool
+	// done holds the last result of each request an earlier run of the
+	// task replayed.
+	done  map[traffic.CaptureID]replay.Result
+	tally tally
+}
+
+// replayTask replays the task's sessions one after the other, at the job's
+// speed. A request that gets no response fails the task, but the remaining
+// requests are still replayed. Requests an earlier run already answered are
+// not sent again; see pending.
+func (s *Service) replayTask(ctx context.Context, task replay.Task) error {
+	job, err := s.repo.GetReplayJob(ctx, task.JobID)
+	if err != nil {
+		return err
+	}
+	target, err := s.repo.GetShadowTarget(ctx, job.ShadowTargetID)
+	if err != nil {
+		return err
+	}
+	base, err := baseURL(target)
+	if err != nil {
+		return err
+	}
+	run := &taskRun{task: task, params: job.Params, target: target, base: base, retryOn: retryOn(target.Retry, task)}
+	if job.Params.Mode == replay.ModeLoad {
+		return s.runLoad(ctx, run)
+	}
+	if target.ReplayStrategy == replay.StrategyThreeWay {
+		if run.baselines, err = baselineURLs(target); err != nil {
+			return err
+		}
+		if run.noise, err = s.jobNoise(ctx, job.ID); err != nil {
+			return err
+		}
+	}
+	rules, err := s.rules(ctx, job)
+	if err != nil {
+		return err
+	}
+	done, err := s.repo.ListTaskResults(ctx, task.ID)
+	if err != nil {
+		return fmt.Errorf("list task results: %w", err)
+	}
+	run.done = make(map[traffic.CaptureID]replay.Result, len(done))
+	for _, r := range done {
+		run.done[r.TrafficRequestID] = r
+	}
+
+	for _, sessionID := range task.SessionIDs {
+		records, err := s.traffic.ListSessionRequests(ctx, sessionID)
+		if err != nil {
+			return fmt.Errorf("load session %s: %w", sessionID, err)
+		}
+		if err := s.replaySession(ctx, run, run.pending(records), newSessionState(rules)); err != nil {
+			return err
+		}
+	}
+	return retry(run, run.tally.err())
+}
+
+// pending drops the requests an earlier run of the task has results for,
+// tallying those results as if they had just been replayed. A run cut short
+// by a pause goes on after the last request it replayed; a retry, or a run
+// after a lost lease, sends again only the requests that failed. Values the
+// transform rules took from the dropped responses are not learned again.
+func (run *taskRun) pending(records []traffic.CapturedTraffic) []traffic.CapturedTraffic {
+	var left []traffic.CapturedTraffic
+	for _, t := range records {
+		r, ok := run.done[t.ID]
+		if !ok {
+			left = append(left, t)
+			continue
+		}
+		err := run.failure(r)
+		if err != nil && r.Attempt < run.task.Attempt {
+			left = append(left, t)
+			continue
+		}
+		run.tally.add(err)
+	}
+	return left
+}
+
+// failure returns the error a request's result counts as for the task, nil
+// when it did not fail.
+func (run *taskRun) failure(r replay.Result) error {
+	switch {
+	case r.Status == replay.ResultFailed:
+		return priorError{class: r.ErrorClass, message: r.ErrorMessage}
+	case r.ErrorClass == classServerError && run.retryOn[classServerError]:
+		return serverError{code: r.StatusCode}
+	}
 	return nil
 }
+
+// priorError is a failure recorded by an earlier run of the task.
+type priorError struct {
+	class, message string
+}
+
+func (e priorError) Error() string { return e.message }
+
+// sessionState is the transform state of one session, kept apart for every
+// instance the session is replayed against since each issues its own
+// values. It is nil when the job has no transform rules.
+type sessionState struct {
+	rules *apptransform.Rules
+
+	mu        sync.Mutex
+	instances map[string]*apptransform.Session
+}
+
+func newSessionState(rules *apptransform.Rules) *sessionState {
+	if rules == nil {
+		return nil
+	}
+	return &sessionState{rules: rules, instances: make(map[string]*apptransform.Session)}
+}
+
+func (st *sessionState) of(instance *url.URL) *apptransform.Session {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sess, ok := st.instances[instance.String()]
+	if !ok {
+		sess = st.rules.NewSession()
+		st.instances[instance.String()] = sess
+	}
+	return sess
+}
+
+// learn runs the extraction rules over the captured response and what
+// instance answered.
+func (st *sessionState) learn(instance *url.URL, t traffic.CapturedTraffic, original appdiff.Exchange, out Outcome) {
+	if st == nil {
+		return
+	}
+	st.of(instance).Learn(t,
+		apptransform.Message{Headers: original.Response.Headers, Body: original.Body},
+		apptransform.Message{Headers: out.Response.Headers, Body: out.Data})
+}
+
+// replayRequest sends one captured request and records the result and its
+// diff. With transform rules, the request carries the values learned from
+// earlier responses and its response is learned from in turn. It returns
+// the error that kept the request from being answered; a request the guard
+// blocks is recorded as skipped and is no error.
+func (s *Service) replayRequest(ctx context.Context, run *taskRun, t traffic.CapturedTraffic, st *sessionState) error {
+	if b := s.guard(run, t, st); b != nil {
+		return s.skipRequest(ctx, run, t, b)
+	}
+	var (
+		baselines   []Outcome
+		baselineErr error
+		wg          sync.WaitGroup
+	)
+	if run.baselines != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			baselines, baselineErr = s.sendBaselines(ctx, run, t, st)
+		}()
+	}
+	out, sendErr := s.send(ctx, run.base, t, st.of(run.base))
+	wg.Wait()
+	if sendErr != nil && ctx.Err() != nil {
+		// Interrupted by shutdown, a pause or a cancel; the task is
+		// replayed again or not at all.
+		return sendErr
+	}
+
+	result := replay.Result{
+		ID:               replay.ResultID(uuid.NewString()),
+		TaskID:           run.task.ID,
+		TrafficRequestID: t.ID,
+		Attempt:          run.task.Attempt,
+		FinishedAt:       time.Now().UTC(),
+	}
+	if sendErr != nil {
+		result.Status = replay.ResultFailed
+		result.ErrorClass = errorClass(sendErr)
+		result.ErrorMessage = sendErr.Error()
+	} else {
+		result.Status = replay.ResultSucceeded
+		result.StatusCode = out.Response.StatusCode
+		result.Latency = out.Latency
+		result.ResponseSize = out.Response.Body.Size
+		result.ResponseHash = out.Response.Body.Hash
+		if result.StatusCode >= 500 {
+			result.ErrorClass = classServerError
+		}
+	}
+	if err := s.repo.SaveResult(ctx, result); err != nil {
+		return fmt.Errorf("save replay result: %w", err)
+	}
+
+	d := diff.DiffResult{
+		ID:             diff.DiffID(uuid.NewString()),
+		ReplayResultID: result.ID,
+		CreatedAt:      time.Now().UTC(),
+		Strategy:       run.target.DiffStrategy,
+		Fingerprint:    t.Fingerprint,
+		Endpoint:       s.endpoint(t),
+	}
+	var original appdiff.Exchange
+	err := sendErr
+	if err == nil {
+		original, err = s.original(ctx, t)
+	}
+	switch {
+	case err != nil:
+		d.Status = diff.StatusError
+		d.ErrorMessage = err.Error()
+	case run.baselines == nil:
+		st.learn(run.base, t, original, out)
+		cmp := s.opts.Comparer.Compare(t, original, exchange(out))
+		d.Status = cmp.Status
+		d.Changes = cmp.Changes
+	case baselineErr != nil:
+		st.learn(run.base, t, original, out)
+		d.Status = diff.StatusError
+		d.ErrorMessage = baselineErr.Error()
+	default:
+		st.learn(run.base, t, original, out)
+		for i, b := range baselines {
+			st.learn(run.baselines[i], t, original, b)
+		}
+		s.compareThreeWay(&d, run, t, baselines, out)
+	}
+	if err := s.diffs.SaveDiffResult(ctx, d); err != nil {
+		return fmt.Errorf("save diff result: %w", err)
+	}
+	if sendErr == nil && result.StatusCode >= 500 && run.retryOn[classServerError] {
+		return serverError{code: result.StatusCode}
+	}
+	return sendErr
+}
+
+func exchange(out Outcome) appdiff.Exchange {
+	return appdiff.Exchange{Response: out.Response, Body: out.Data, Frames: out.Frames, FrameData: out.FrameData}
+}
+
+// skipRequest records a request the guard kept from the target.
+func (s *Service) skipRequest(ctx context.Context, run *taskRun, t traffic.CapturedTraffic, b *blocked) error {
+	result := replay.Result{
+		ID:               replay.ResultID(uuid.NewString()),
+		TaskID:           run.task.ID,
+		TrafficRequestID: t.ID,
+		Attempt:          run.task.Attempt,
+		Status:           replay.ResultSkipped,
+		ErrorClass:       b.class,
+		ErrorMessage:     b.message,
+		FinishedAt:       time.Now().UTC(),
+	}
+	if err := s.repo.SaveResult(ctx, result); err != nil {
+		return fmt.Errorf("save replay result: %w", err)
+	}
+	d := diff.DiffResult{
+		ID:             diff.DiffID(uuid.NewString()),
+		ReplayResultID: result.ID,
+		CreatedAt:      time.Now().UTC(),
+		Status:         diff.StatusSkipped,
+		Strategy:       run.target.DiffStrategy,
+		ErrorMessage:   b.message,
+		Fingerprint:    t.Fingerprint,
+		Endpoint:       s.endpoint(t),
+	}
+	if err := s.diffs.SaveDiffResult(ctx, d); err != nil {
+		return fmt.Errorf("save diff result: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) send(ctx context.Context, base *url.URL, t traffic.CapturedTraffic, sess *apptransform.Session) (Outcome, error) {
+	if t.Protocol == traffic.ProtocolWebSocket {
+		if sess != nil {
+			t, _ = sess.Apply(t, nil)
+		}
+		payloads, err := s.load(ctx, t.Frames)
+		if err != nil {
+			return Outcome{}, err
+		}
+		return s.opts.Sender.SendWebSocket(ctx, base, t, payloads)
+	}
+	body, err := payload.Load(ctx, s.opts.Blobs, t.Request.Body)
+	if err != nil {
+		return Outcome{}, fmt.Errorf("load request body: %w", err)
+	}
+	if sess != nil {
+		t, body = sess.Apply(t, body)
+	}
+	return s.opts.Sender.Send(ctx, base, t, body)
+}
+
+// original loads the captured side of the comparison.
+func (s *Service) original(ctx context.Context, t traffic.CapturedTraffic) (appdiff.Exchange, error) {
+	body, err := payload.Load(ctx, s.opts.Blobs, t.Response.Body)
+	if err != nil {
+		return appdiff.Exchange{}, fmt.Errorf("load response body: %w", err)
+	}
+	frames, err := s.load(ctx, t.Frames)
+	if err != nil {
+		return appdiff.Exchange{}, err
+	}
+	return appdiff.Exchange{Response: t.Response, Body: body, Frames: t.Frames, FrameData: frames}, nil
+}
+
+func (s *Service) load(ctx context.Context, frames []traffic.Frame) ([][]byte, error) {
+	payloads := make([][]byte, len(frames))
+	for i, f := range frames {
+		data, err := payload.Load(ctx, s.opts.Blobs, f.Body)
+		if err != nil {
+			return nil, fmt.Errorf("load websocket frame %d: %w", i, err)
+		}
+		payloads[i] = data
+	}
+	return payloads, nil
+}
+
+func (s *Service) endpoint(t traffic.CapturedTraffic) string {
+	if f := s.opts.Fingerprinter; f != nil {
+		return f.Endpoint(t.Method, t.Request.Path)
+	}
+	return t.Method + " " + t.Request.Path
+}
+
+// errorClass buckets a send error for replay_results.error_class.
+func errorClass(err error) string {
+	var (
+		netErr net.Error
+		prior  priorError
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection_reset"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, new(serverError)):
+		return classServerError
+	case errors.As(err, &prior):
+		return prior.class
+	default:
+		return "transport"
+	}
+}
@@ -0,0 +1,105 @@
+package replay
+
+import (
+	"fmt"
+	"time"
+
+	"synthema/internal/domain/replay"
+	"synthema/pkg/backoff"
+)
+
+// classServerError is the error class of a 5xx response. The target did
+// answer, so the request is only counted as failed when the shadow target's
+// retry policy names the class.
+const classServerError = "server_error"
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+	retryJitter           = 0.5
+)
+
+var (
+	defaultRetryOn   = []string{"timeout", "connection_refused", classServerError}
+	retryableClasses = map[string]bool{
+		"timeout":            true,
+		"connection_refused": true,
+		"connection_reset":   true,
+		"transport":          true,
+		classServerError:     true,
+	}
+)
+
+func validateRetryPolicy(p replay.RetryPolicy) error {
+	if p.MaxAttempts < 0 || p.InitialBackoffMS < 0 || p.MaxBackoffMS < 0 {
+		return fmt.Errorf("retry policy must not be negative")
+	}
+	for _, class := range p.RetryOn {
+		if !retryableClasses[class] {
+			return fmt.Errorf("retry policy: error class %q", class)
+		}
+	}
+	return nil
+}
+
+// retryOn returns the error classes the policy retries the task for, or nil
+// when it allows no retries. A request that fails with one of them fails the
+// task on its last attempt too.
+func retryOn(p replay.RetryPolicy, task replay.Task) map[string]bool {
+	if task.Type == replay.TaskLoad || p.MaxAttempts <= 1 {
+		return nil
+	}
+	classes := p.RetryOn
+	if len(classes) == 0 {
+		classes = defaultRetryOn
+	}
+	on := make(map[string]bool, len(classes))
+	for _, class := range classes {
+		on[class] = true
+	}
+	return on
+}
+
+func retryBackoff(p replay.RetryPolicy) backoff.Exponential {
+	b := backoff.Exponential{
+		Initial: time.Duration(p.InitialBackoffMS) * time.Millisecond,
+		Max:     time.Duration(p.MaxBackoffMS) * time.Millisecond,
+		Jitter:  retryJitter,
+	}
+	if b.Initial <= 0 {
+		b.Initial = defaultInitialBackoff
+	}
+	if b.Max <= 0 {
+		b.Max = max(defaultMaxBackoff, b.Initial)
+	}
+	return b
+}
+
+// serverError is a 5xx response when the retry policy names server_error.
+type serverError struct {
+	code int
+}
+
+func (e serverError) Error() string {
+	return fmt.Sprintf("target answered %d", e.code)
+}
+
+// retryError is the error of an attempt that is retried after the backoff.
+type retryError struct {
+	after time.Duration
+	err   error
+}
+
+func (e *retryError) Error() string { return e.err.Error() }
+
+func (e *retryError) Unwrap() error { return e.err }
+
+// retry wraps the error of a task's attempt in a retryError when it has
+// attempts left and every request that failed did so with an error class
+// the shadow target retries.
+func retry(run *taskRun, err error) error {
+	if err == nil || run.task.Attempt >= run.target.Retry.MaxAttempts || !run.tally.only(run.retryOn) {
+		return err
+	}
+	return &retryError{after: retryBackoff(run.target.Retry).Delay(run.task.Attempt), err: err}
+}
@@ -0,0 +1,93 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"synthema/internal/domain/replay"
+)
+
+// startScheduled starts a job for every shadow target schedule that fired
+// within the grace period before now. Several workers may do this at once:
+// the repository keeps one job per schedule run, so only the first one
+// saves it.
+func (s *Service) startScheduled(ctx context.Context, now time.Time) {
+	targets, err := s.repo.ListScheduledTargets(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Error(fmt.Sprintf("list scheduled shadow targets: %v", err))
+		}
+		return
+	}
+	for _, target := range targets {
+		seen := make(map[string]bool, len(target.Schedules))
+		for _, sch := range target.Schedules {
+			if sch.Name == "" || seen[sch.Name] {
+				s.logger.Error(fmt.Sprintf("shadow target %s: schedules need distinct names, got %q", target.ID, sch.Name))
+				continue
+			}
+			seen[sch.Name] = true
+			if sch.Disabled {
+				continue
+			}
+			if err := s.startSchedule(ctx, target, sch, now); err != nil && ctx.Err() == nil {
+				s.logger.Error(fmt.Sprintf("replay schedule %q of shadow target %s: %v", sch.Name, target.ID, err))
+			}
+		}
+	}
+}
+
+func (s *Service) startSchedule(ctx context.Context, target replay.ShadowTarget, sch replay.Schedule, now time.Time) error {
+	at, ok, err := lastRun(sch, now, s.opts.ScheduleGrace)
+	if err != nil || !ok {
+		return err
+	}
+	if sch.WindowSeconds < 0 {
+		return fmt.Errorf("window must not be negative")
+	}
+	params := sch.Params
+	if sch.WindowSeconds > 0 {
+		from := at.Add(-time.Duration(sch.WindowSeconds) * time.Second)
+		params.From, params.To = &from, &at
+	}
+	if err := validateParams(params); err != nil {
+		return err
+	}
+	job, err := s.newJob(ctx, target, sch.TransformRuleSetID, params)
+	if err != nil {
+		return err
+	}
+	job.ScheduleName = sch.Name
+	job.ScheduledFor = &at
+	created, err := s.repo.CreateScheduledJob(ctx, job)
+	if err != nil {
+		return err
+	}
+	if created {
+		s.logger.Info(fmt.Sprintf("replay job %s queued by schedule %q of shadow target %s for %s", job.ID, sch.Name, target.ID, at.Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// lastRun finds the latest minute, no later than now and at most grace
+// before it, at which the schedule fires.
+func lastRun(sch replay.Schedule, now time.Time, grace time.Duration) (time.Time, bool, error) {
+	spec, err := parseCron(sch.Cron)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	loc := time.UTC
+	if sch.Timezone != "" {
+		if loc, err = time.LoadLocation(sch.Timezone); err != nil {
+			return time.Time{}, false, fmt.Errorf("timezone %q: %w", sch.Timezone, err)
+		}
+	}
+	earliest := now.Add(-grace)
+	for t := now.In(loc).Truncate(time.Minute); !t.Before(earliest); t = t.Add(-time.Minute) {
+		if spec.matches(t) {
+			return t.UTC(), true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
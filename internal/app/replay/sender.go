@@ -0,0 +1,188 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"synthema/internal/adapters/grpcwire"
+	"synthema/internal/app/privacy"
+	"synthema/internal/domain/traffic"
+)
+
+const defaultSendTimeout = 30 * time.Second
+
+// ErrHostNotAllowed is returned for targets outside the sender's allowlist.
+var ErrHostNotAllowed = errors.New("target host is not on the replay allowlist")
+
+// hopHeaders are connection-specific and never replayed.
+var hopHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Sender sends captured requests to a shadow target. gRPC calls go over
+// HTTP/2, cleartext for http:// targets; everything else uses HTTP/1.1 or
+// HTTP/2 as negotiated. Redirects are returned, not followed, so they can
+// be compared with the captured response, and so that nothing reaches a
+// host outside the allowlist.
+type Sender struct {
+	client       *http.Client
+	h2c          *http.Client
+	timeout      time.Duration
+	maxBodyBytes int64
+	allowedHosts []string
+}
+
+// Outcome is the shadow target's answer to one request. Response bodies
+// keep at most maxBodyBytes inline; Data holds the full body for diffing.
+// For WebSocket connections Frames and FrameData hold the messages the
+// target sent, likewise.
+type Outcome struct {
+	Response  traffic.Response
+	Data      []byte
+	Latency   time.Duration
+	Frames    []traffic.Frame
+	FrameData [][]byte
+}
+
+// NewSender only sends to the allowed hosts, given as names like
+// "shadow.internal" or wildcards like "*.shadow.internal", which allow the
+// domain and the hosts below it. Any other entry with a "*" allows nothing.
+// An empty list allows none.
+func NewSender(timeout time.Duration, maxBodyBytes int64, allowedHosts []string) *Sender {
+	if timeout <= 0 {
+		timeout = defaultSendTimeout
+	}
+	noRedirect := func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	h2cTransport := http.DefaultTransport.(*http.Transport).Clone()
+	h2cTransport.Protocols = new(http.Protocols)
+	h2cTransport.Protocols.SetUnencryptedHTTP2(true)
+
+	return &Sender{
+		client:       &http.Client{Transport: transport, Timeout: timeout, CheckRedirect: noRedirect},
+		h2c:          &http.Client{Transport: h2cTransport, Timeout: timeout, CheckRedirect: noRedirect},
+		timeout:      timeout,
+		maxBodyBytes: maxBodyBytes,
+		allowedHosts: allowedHosts,
+	}
+}
+
+// AllowsAny reports whether the allowlist names any host at all.
+func (s *Sender) AllowsAny() bool {
+	return len(s.allowedHosts) > 0
+}
+
+// Allowed reports ErrHostNotAllowed unless target is on the allowlist.
+func (s *Sender) Allowed(target *url.URL) error {
+	host := strings.ToLower(target.Hostname())
+	for _, allowed := range s.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if domain, ok := strings.CutPrefix(allowed, "*."); ok {
+			if domain != "" && !strings.Contains(domain, "*") && (host == domain || strings.HasSuffix(host, "."+domain)) {
+				return nil
+			}
+			continue
+		}
+		if host == allowed && !strings.Contains(allowed, "*") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+}
+
+// Send replays t against target with the given request body, which for
+// gRPC is the unframed message.
+func (s *Sender) Send(ctx context.Context, target *url.URL, t traffic.CapturedTraffic, body []byte) (Outcome, error) {
+	if err := s.Allowed(target); err != nil {
+		return Outcome{}, err
+	}
+	u := targetURL(target, t)
+	grpc := t.Protocol == traffic.ProtocolGRPC
+	if grpc {
+		body = grpcwire.Frame(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, t.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return Outcome{}, err
+	}
+	req.Header = replayHeaders(t.Request.Headers)
+	client := s.client
+	if grpc {
+		// Messages are sent uncompressed, whatever the original used.
+		req.Header.Del("Grpc-Encoding")
+		req.Header.Set("Te", "trailers")
+		if u.Scheme == "http" {
+			client = s.h2c
+		}
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Outcome{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	latency := time.Since(start)
+	if err != nil {
+		return Outcome{}, err
+	}
+
+	if grpc && len(data) > 0 {
+		if msg, err := grpcwire.Unframe(data, resp.Header.Get("Grpc-Encoding")); err == nil {
+			data = msg
+		}
+	}
+	return Outcome{
+		Response: traffic.Response{
+			StatusCode: resp.StatusCode,
+			Headers:    resp.Header,
+			Trailers:   resp.Trailer,
+			Body:       traffic.NewBody(data, s.maxBodyBytes),
+		},
+		Data:    data,
+		Latency: latency,
+	}, nil
+}
+
+func targetURL(target *url.URL, t traffic.CapturedTraffic) url.URL {
+	u := *target
+	u.Path = strings.TrimSuffix(u.Path, "/") + t.Request.Path
+	u.RawPath = ""
+	u.RawQuery = t.Request.QueryString
+	return u
+}
+
+// replayHeaders copies the captured headers without hop-by-hop headers and
+// without values scrubbed at capture, which would only be rejected.
+func replayHeaders(captured http.Header) http.Header {
+	h := make(http.Header, len(captured))
+	for name, values := range captured {
+		for _, v := range values {
+			if v != privacy.Redacted {
+				h.Add(name, v)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+	return h
+}
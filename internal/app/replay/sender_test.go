@@ -0,0 +1,39 @@
+package replay
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestSenderAllowed(t *testing.T) {
+	for _, tc := range []struct {
+		allowlist []string
+		host      string
+		allowed   bool
+	}{
+		{nil, "shadow.example.com", false},
+		{[]string{"*"}, "shadow.example.com", false},
+		{[]string{"*example.com"}, "evilexample.com", false},
+		{[]string{"*example.com"}, "example.com", false},
+		{[]string{"*."}, "example.com", false},
+		{[]string{"shadow.example.com"}, "shadow.example.com", true},
+		{[]string{"shadow.example.com"}, "SHADOW.example.com", true},
+		{[]string{"shadow.example.com"}, "api.shadow.example.com", false},
+		{[]string{"*.example.com"}, "example.com", true},
+		{[]string{"*.example.com"}, "shadow.example.com", true},
+		{[]string{"*.example.com"}, "a.shadow.example.com", true},
+		{[]string{"*.example.com"}, "evilexample.com", false},
+		{[]string{"*.example.com"}, "payments-example.com", false},
+		{[]string{"*.example.com"}, "example.com.evil.net", false},
+	} {
+		s := NewSender(0, 0, tc.allowlist)
+		err := s.Allowed(&url.URL{Scheme: "https", Host: tc.host + ":8443"})
+		if got := err == nil; got != tc.allowed {
+			t.Errorf("allowlist %q, host %s: allowed = %v, want %v", tc.allowlist, tc.host, got, tc.allowed)
+		}
+		if err != nil && !errors.Is(err, ErrHostNotAllowed) {
+			t.Errorf("allowlist %q, host %s: error %v is not ErrHostNotAllowed", tc.allowlist, tc.host, err)
+		}
+	}
+}
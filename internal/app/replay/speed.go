@@ -0,0 +1,149 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"synthema/internal/domain/common"
+	"synthema/internal/domain/replay"
+	"synthema/internal/domain/traffic"
+)
+
+// validateSpeed checks the speed settings of a job's params.
+func validateSpeed(p replay.JobParams) error {
+	switch p.Speed {
+	case "", replay.SpeedMax:
+	case replay.SpeedRealTime:
+		if p.SpeedFactor != 0 && p.SpeedFactor != 1 {
+			return fmt.Errorf("%w: speed factor needs speed %q", common.ErrInvalidInput, replay.SpeedAccelerated)
+		}
+	case replay.SpeedAccelerated:
+		if p.SpeedFactor <= 0 {
+			return fmt.Errorf("%w: speed %q needs a positive speed factor", common.ErrInvalidInput, p.Speed)
+		}
+	default:
+		return fmt.Errorf("%w: speed %q", common.ErrInvalidInput, p.Speed)
+	}
+	if p.MaxInFlight < 0 {
+		return fmt.Errorf("%w: max in flight must not be negative", common.ErrInvalidInput)
+	}
+	if p.MaxInFlight > 1 && p.Speed != "" && p.Speed != replay.SpeedMax {
+		return fmt.Errorf("%w: max in flight needs speed %q", common.ErrInvalidInput, replay.SpeedMax)
+	}
+	return nil
+}
+
+// tally counts the requests of a task and the ones that failed, by error
+// class.
+type tally struct {
+	mu            sync.Mutex
+	total, failed int
+	first         error
+	classes       map[string]int
+}
+
+func (t *tally) add(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total++
+	if err != nil {
+		t.failed++
+		if t.first == nil {
+			t.first = err
+		}
+		if t.classes == nil {
+			t.classes = make(map[string]int)
+		}
+		t.classes[errorClass(err)]++
+	}
+}
+
+// only reports whether requests failed and all with one of the classes.
+func (t *tally) only(classes map[string]bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for class := range t.classes {
+		if !classes[class] {
+			return false
+		}
+	}
+	return t.failed > 0
+}
+
+func (t *tally) err() error {
+	if t.failed > 0 {
+		return fmt.Errorf("%d of %d requests failed, first: %w", t.failed, t.total, t.first)
+	}
+	return nil
+}
+
+// replaySession replays one session's requests at the job's speed. In real
+// time and accelerated mode requests go out one after the other, each at
+// its captured offset from the session's first request, scaled; a request
+// that is due while the previous one is still waiting for its answer goes
+// out right after it.
+func (s *Service) replaySession(ctx context.Context, run *taskRun, records []traffic.CapturedTraffic, st *sessionState) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if run.params.Speed == "" || run.params.Speed == replay.SpeedMax {
+		return s.replayMax(ctx, run, max(run.params.MaxInFlight, 1), records, st)
+	}
+
+	factor := 1.0
+	if run.params.Speed == replay.SpeedAccelerated {
+		factor = run.params.SpeedFactor
+	}
+	start, first := time.Now(), records[0].CapturedAt
+	for _, t := range records {
+		offset := time.Duration(float64(t.CapturedAt.Sub(first)) / factor)
+		if err := sleep(ctx, time.Until(start.Add(offset))); err != nil {
+			return err
+		}
+		run.tally.add(s.replayRequest(ctx, run, t, st))
+	}
+	return nil
+}
+
+// replayMax sends up to inFlight requests at once, in sequence order. With
+// more than one in flight, a request may go out before the response it
+// takes values from has been learned.
+func (s *Service) replayMax(ctx context.Context, run *taskRun, inFlight int, records []traffic.CapturedTraffic, st *sessionState) error {
+	slots := make(chan struct{}, inFlight)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, t := range records {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			run.tally.add(s.replayRequest(ctx, run, t, st))
+		}()
+	}
+	return nil
+}
+
+// sleep waits for d unless ctx is cancelled first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,130 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+
+	appdiff "synthema/internal/app/diff"
+	"synthema/internal/domain/common"
+	"synthema/internal/domain/diff"
+	"synthema/internal/domain/replay"
+	"synthema/internal/domain/traffic"
+)
+
+// baselineURLs parses the two baseline instances of a three-way target.
+func baselineURLs(target replay.ShadowTarget) ([]*url.URL, error) {
+	if len(target.BaselineURLs) != 2 {
+		return nil, fmt.Errorf("shadow target %s replays three-way but has %d baseline urls instead of 2", target.ID, len(target.BaselineURLs))
+	}
+	urls := make([]*url.URL, len(target.BaselineURLs))
+	for i, raw := range target.BaselineURLs {
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("shadow target %s has an invalid baseline url %q", target.ID, raw)
+		}
+		urls[i] = u
+	}
+	return urls, nil
+}
+
+// sendBaselines sends t to both baselines at once. It fails if either gets
+// no response.
+func (s *Service) sendBaselines(ctx context.Context, run *taskRun, t traffic.CapturedTraffic, st *sessionState) ([]Outcome, error) {
+	outs := make([]Outcome, len(run.baselines))
+	errs := make([]error, len(run.baselines))
+	var wg sync.WaitGroup
+	for i, base := range run.baselines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outs[i], errs[i] = s.send(ctx, base, t, st.of(base))
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("baseline %s: %w", run.baselines[i].Host, err)
+		}
+	}
+	return outs, nil
+}
+
+// compareThreeWay diffs the target against the first baseline. What the two
+// baselines disagree on is learned as noise for the endpoint and, with the
+// noise-aware diff strategy, left out of the changes.
+func (s *Service) compareThreeWay(d *diff.DiffResult, run *taskRun, t traffic.CapturedTraffic, baselines []Outcome, out Outcome) {
+	key := noiseKey(d.Fingerprint, d.Endpoint)
+	primary := exchange(baselines[0])
+	run.noise.Learn(key, s.opts.Comparer.Compare(t, primary, exchange(baselines[1])).Changes)
+
+	changes := s.opts.Comparer.Compare(t, primary, exchange(out)).Changes
+	if run.target.DiffStrategy == diff.StrategyNoiseAware {
+		changes = run.noise.Filter(key, changes)
+	}
+	d.Noise = run.noise.Paths(key)
+	d.Changes = changes
+	d.Status = diff.StatusMatched
+	if len(changes) > 0 {
+		d.Status = diff.StatusMismatched
+	}
+}
+
+// noiseKey is what noise is learned under: the endpoint fingerprint, or the
+// endpoint label for traffic captured without one.
+func noiseKey(fingerprint, endpoint string) string {
+	if fingerprint != "" {
+		return fingerprint
+	}
+	return endpoint
+}
+
+// jobNoise returns the noise model a job's tasks share on this worker, so
+// noise learned in one session filters the diffs of the next. The first
+// task of a job on a worker seeds it with the noise the job's diffs hold,
+// which carries over what other workers and earlier runs learned.
+func (s *Service) jobNoise(ctx context.Context, id replay.ReplayID) (*appdiff.Noise, error) {
+	s.noiseMu.Lock()
+	defer s.noiseMu.Unlock()
+	if n, ok := s.noise[id]; ok {
+		return n, nil
+	}
+	diffs, err := s.diffs.ListJobDiffResults(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("load noise of replay job %s: %w", id, err)
+	}
+	n := appdiff.NewNoise()
+	for _, d := range diffs {
+		n.Add(noiseKey(d.Fingerprint, d.Endpoint), d.Noise)
+	}
+	s.noise[id] = n
+	return n, nil
+}
+
+func (s *Service) dropNoise(id replay.ReplayID) {
+	s.noiseMu.Lock()
+	defer s.noiseMu.Unlock()
+	delete(s.noise, id)
+}
+
+// pruneNoise drops the noise models of jobs that are over, including those
+// another worker finished.
+func (s *Service) pruneNoise(ctx context.Context) {
+	s.noiseMu.Lock()
+	ids := make([]replay.ReplayID, 0, len(s.noise))
+	for id := range s.noise {
+		ids = append(ids, id)
+	}
+	s.noiseMu.Unlock()
+	for _, id := range ids {
+		job, err := s.repo.GetReplayJob(ctx, id)
+		if err != nil && !errors.Is(err, common.ErrNotFound) {
+			continue
+		}
+		if err != nil || job.Status.Done() {
+			s.dropNoise(id)
+		}
+	}
+}
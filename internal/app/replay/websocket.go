@@ -0,0 +1,233 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"synthema/internal/adapters/wsframe"
+	"synthema/internal/domain/traffic"
+)
+
+// wsSettle is how long the target may keep answering after the last
+// recorded frame before the connection is closed.
+const wsSettle = time.Second
+
+// SendWebSocket opens a WebSocket connection to target with the captured
+// upgrade request and sends the client frames, given their payloads, at
+// their original offsets. It returns once the connection is closed, by
+// either side, or wsSettle after the last recorded frame.
+func (s *Sender) SendWebSocket(ctx context.Context, target *url.URL, t traffic.CapturedTraffic, payloads [][]byte) (Outcome, error) {
+	if err := s.Allowed(target); err != nil {
+		return Outcome{}, err
+	}
+	u := targetURL(target, t)
+	start := time.Now()
+	conn, err := s.dialWebSocket(ctx, &u)
+	if err != nil {
+		return Outcome{}, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Outcome{}, err
+	}
+	req.Header = replayHeaders(t.Request.Headers)
+	// A fresh key, and no extensions so the target does not compress.
+	req.Header.Del("Sec-WebSocket-Extensions")
+	req.Header.Set("Sec-WebSocket-Key", newWebSocketKey())
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	_ = conn.SetDeadline(time.Now().Add(s.timeout))
+	if err := req.Write(conn); err != nil {
+		return Outcome{}, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return Outcome{}, err
+	}
+	out := Outcome{
+		Response: traffic.Response{StatusCode: resp.StatusCode, Headers: resp.Header},
+		Latency:  time.Since(start),
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		// A refused upgrade is an ordinary response to diff.
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return Outcome{}, err
+		}
+		out.Data = data
+		out.Response.Body = traffic.NewBody(data, s.maxBodyBytes)
+		return out, nil
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	ws := &wsConn{conn: conn, upgraded: time.Now(), maxBodyBytes: s.maxBodyBytes, done: make(chan struct{})}
+	go ws.readLoop(br)
+
+	var last time.Duration
+	for i, f := range t.Frames {
+		last = max(last, f.Offset)
+		if f.Direction != traffic.FrameFromClient {
+			continue
+		}
+		if !ws.waitUntil(ctx, f.Offset) {
+			break
+		}
+		var data []byte
+		if i < len(payloads) {
+			data = payloads[i]
+		}
+		if err := ws.write(byte(f.Opcode), data); err != nil {
+			break
+		}
+	}
+	if !ws.waitUntil(ctx, last+wsSettle) {
+		return ws.outcome(out), ctx.Err()
+	}
+	// Close politely and give the target a moment to answer in kind.
+	_ = ws.write(wsframe.OpClose, []byte{0x03, 0xE8})
+	select {
+	case <-ws.done:
+	case <-time.After(wsSettle):
+	case <-ctx.Done():
+	}
+	return ws.outcome(out), ctx.Err()
+}
+
+func (s *Sender) dialWebSocket(ctx context.Context, u *url.URL) (net.Conn, error) {
+	host := u.Host
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+	if u.Port() == "" {
+		port := "80"
+		if secure {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: s.timeout}
+	if !secure {
+		return dialer.DialContext(ctx, "tcp", host)
+	}
+	// ALPN is not offered, so the upgrade happens over HTTP/1.1.
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: u.Hostname()}}
+	return tlsDialer.DialContext(ctx, "tcp", host)
+}
+
+// wsConn is the client end of a replayed WebSocket connection.
+type wsConn struct {
+	conn         net.Conn
+	upgraded     time.Time
+	maxBodyBytes int64
+	done         chan struct{}
+
+	writeMu sync.Mutex
+	closed  bool
+
+	mu     sync.Mutex
+	frames []traffic.Frame
+	data   [][]byte
+}
+
+// readLoop records the target's messages until the connection ends,
+// answering pings and the closing handshake as a client must.
+func (c *wsConn) readLoop(br *bufio.Reader) {
+	defer close(c.done)
+	parser := wsframe.NewParser(0)
+	var asm wsframe.Assembler
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := br.Read(buf)
+		frames, perr := parser.Write(buf[:n])
+		for _, f := range frames {
+			msg, ok := asm.Add(f)
+			if !ok {
+				continue
+			}
+			c.record(msg)
+			switch msg.Opcode {
+			case wsframe.OpPing:
+				_ = c.write(wsframe.OpPong, msg.Payload)
+			case wsframe.OpClose:
+				_ = c.write(wsframe.OpClose, msg.Payload)
+				return
+			}
+		}
+		if err != nil || perr != nil {
+			return
+		}
+	}
+}
+
+func (c *wsConn) record(msg wsframe.Frame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frames = append(c.frames, traffic.Frame{
+		Offset:    time.Since(c.upgraded),
+		Direction: traffic.FrameFromServer,
+		Opcode:    int(msg.Opcode),
+		Body:      traffic.NewBody(msg.Payload, c.maxBodyBytes),
+	})
+	c.data = append(c.data, msg.Payload)
+}
+
+// write sends one masked frame. Nothing is sent after a close frame.
+func (c *wsConn) write(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	if opcode == wsframe.OpClose {
+		c.closed = true
+	}
+	if err := wsframe.Write(c.conn, opcode, payload, true); err != nil {
+		return fmt.Errorf("write websocket frame: %w", err)
+	}
+	return nil
+}
+
+// waitUntil sleeps until offset after the upgrade. It returns false if the
+// connection ended or ctx was cancelled first.
+func (c *wsConn) waitUntil(ctx context.Context, offset time.Duration) bool {
+	timer := time.NewTimer(time.Until(c.upgraded.Add(offset)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.done:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *wsConn) outcome(out Outcome) Outcome {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out.Frames = c.frames
+	out.FrameData = c.data
+	return out
+}
+
+func newWebSocketKey() string {
+	var key [16]byte
+	_, _ = rand.Read(key[:])
+	return base64.StdEncoding.EncodeToString(key[:])
+}
@@ -0,0 +1,79 @@
+package transform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a compiled JSONPath of the form $.a.b[0]['c d']: member and
+// index steps only, no wildcards or filters.
+type jsonPath []pathStep
+
+type pathStep struct {
+	key   string
+	index int
+	isKey bool
+}
+
+func compilePath(expr string) (jsonPath, error) {
+	rest, ok := strings.CutPrefix(expr, "$")
+	if !ok {
+		return nil, fmt.Errorf("json path %q does not start with $", expr)
+	}
+	var path jsonPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("json path %q has an empty member name", expr)
+			}
+			path = append(path, pathStep{key: key, isKey: true})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("json path %q has an unclosed [", expr)
+			}
+			inner := rest[1:end]
+			if n := len(inner); n >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[n-1] == inner[0] {
+				path = append(path, pathStep{key: inner[1 : n-1], isKey: true})
+			} else if i, err := strconv.Atoi(inner); err == nil && i >= 0 {
+				path = append(path, pathStep{index: i})
+			} else {
+				return nil, fmt.Errorf("json path %q has an unsupported step [%s]", expr, inner)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("json path %q is malformed at %q", expr, rest)
+		}
+	}
+	return path, nil
+}
+
+// lookup walks a value decoded with encoding/json.
+func (p jsonPath) lookup(v any) (any, bool) {
+	for _, step := range p {
+		if step.isKey {
+			m, ok := v.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[step.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		a, ok := v.([]any)
+		if !ok || step.index >= len(a) {
+			return nil, false
+		}
+		v = a[step.index]
+	}
+	return v, true
+}
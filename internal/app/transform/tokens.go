@@ -0,0 +1,178 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// learned is a snapshot of a session's values. It is never changed once
+// built; Learn builds a new one.
+type learned struct {
+	values map[string]string
+	// byLength holds the values longest first, so a value that contains
+	// another is replaced as a whole.
+	byLength []string
+}
+
+// with returns a copy of l that also maps from to to.
+func (l *learned) with(from, to string) *learned {
+	next := &learned{values: make(map[string]string, len(l.values)+1)}
+	for k, v := range l.values {
+		next.values[k] = v
+	}
+	next.values[from] = to
+	next.byLength = make([]string, 0, len(next.values))
+	for k := range next.values {
+		next.byLength = append(next.byLength, k)
+	}
+	sort.Slice(next.byLength, func(i, j int) bool {
+		if len(next.byLength[i]) != len(next.byLength[j]) {
+			return len(next.byLength[i]) > len(next.byLength[j])
+		}
+		return next.byLength[i] < next.byLength[j]
+	})
+	return next
+}
+
+// replacePath replaces the path segments that equal a learned value.
+func (l *learned) replacePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		if to, ok := l.values[seg]; ok {
+			segments[i] = to
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// replaceQuery replaces the values of a query string, or of a form body,
+// that equal a learned value once unescaped. Names are left alone.
+func (l *learned) replaceQuery(q string) string {
+	pairs := strings.Split(q, "&")
+	for i, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		raw, err := url.QueryUnescape(value)
+		if err != nil {
+			continue
+		}
+		if to, ok := l.values[raw]; ok {
+			pairs[i] = name + "=" + url.QueryEscape(to)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// replaceWords replaces learned values in free text, such as a header, only
+// where they stand as whole words: 123 is replaced in "Bearer 123" and
+// "id=123", not in "1234" or "x123".
+func (l *learned) replaceWords(s string) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(s); i++ {
+		if i > 0 && isWordByte(s[i-1]) {
+			continue
+		}
+		for _, from := range l.byLength {
+			end := i + len(from)
+			if strings.HasPrefix(s[i:], from) && (end == len(s) || !isWordByte(s[end])) {
+				b.WriteString(s[last:i])
+				b.WriteString(l.values[from])
+				last = end
+				i = end - 1
+				break
+			}
+		}
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '-'
+}
+
+// replaceJSON replaces the string and number values of a JSON document that
+// equal a learned value, leaving member names and the rest of the document
+// byte for byte as it was. A number stays a number when its replacement is
+// one.
+func (l *learned) replaceJSON(doc []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var (
+		out  []byte
+		last int
+		// inObject tracks the open containers; atKey is set while the
+		// next token of the innermost object is a member name.
+		inObject []bool
+		atKey    bool
+	)
+	for {
+		prev := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return doc
+		}
+		if d, ok := tok.(json.Delim); ok {
+			switch d {
+			case '{', '[':
+				inObject = append(inObject, d == '{')
+				atKey = d == '{'
+			default:
+				inObject = inObject[:len(inObject)-1]
+				atKey = len(inObject) > 0 && inObject[len(inObject)-1]
+			}
+			continue
+		}
+		if atKey {
+			atKey = false
+			continue
+		}
+		atKey = len(inObject) > 0 && inObject[len(inObject)-1]
+
+		var from string
+		switch v := tok.(type) {
+		case string:
+			from = v
+		case json.Number:
+			from = v.String()
+		default:
+			continue
+		}
+		to, ok := l.values[from]
+		if !ok {
+			continue
+		}
+		start := int(prev) + bytes.IndexFunc(doc[prev:], func(r rune) bool {
+			return !strings.ContainsRune(" \t\r\n:,", r)
+		})
+		literal := []byte(to)
+		if _, isString := tok.(string); isString || !isJSONNumber(to) {
+			if literal, err = json.Marshal(to); err != nil {
+				return doc
+			}
+		}
+		out = append(append(out, doc[last:start]...), literal...)
+		last = int(dec.InputOffset())
+	}
+	if out == nil {
+		return doc
+	}
+	return append(out, doc[last:]...)
+}
+
+func isJSONNumber(s string) bool {
+	return s != "" && (s[0] == '-' || s[0] >= '0' && s[0] <= '9') && json.Valid([]byte(s))
+}
@@ -1,11 +1,230 @@
 package transform
 
-import "synthema/internal/observability"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
 
+	"synthema/internal/domain/traffic"
+	"synthema/internal/domain/transform"
+	"synthema/internal/observability"
+	"synthema/internal/ports/repository"
+)
+
+// Engine turns transform rule sets into per-session state for replay.
 type Engine struct {
 	logger *observability.Logger
+	rules  repository.TransformRepository
+}
+
+func NewEngine(logger *observability.Logger, rules repository.TransformRepository) *Engine {
+	return &Engine{logger: logger, rules: rules}
+}
+
+func (e *Engine) RuleSet(ctx context.Context, id transform.RuleSetID) (transform.RuleSet, error) {
+	return e.rules.GetRuleSet(ctx, id)
+}
+
+// Rules is a compiled rule set.
+type Rules struct {
+	extractors []extractor
+}
+
+type extractor struct {
+	match   transform.Match
+	source  transform.Source
+	path    jsonPath
+	header  string
+	pattern *regexp.Regexp
+}
+
+// Compile checks a rule set's rules and prepares them for use. Rules with
+// actions replay does not know are left out.
+func (e *Engine) Compile(rs transform.RuleSet) (*Rules, error) {
+	var rules Rules
+	for _, rule := range rs.Rules {
+		if rule.ActionType != transform.ActionExtract {
+			e.logger.Warn(fmt.Sprintf("transform rule %s: action %q is not applied during replay", rule.ID, rule.ActionType))
+			continue
+		}
+		x, err := compileExtraction(rule)
+		if err != nil {
+			return nil, fmt.Errorf("transform rule %s: %w", rule.ID, err)
+		}
+		rules.extractors = append(rules.extractors, x)
+	}
+	return &rules, nil
+}
+
+func compileExtraction(rule transform.Rule) (extractor, error) {
+	if rule.Extract == nil {
+		return extractor{}, fmt.Errorf("extract action has no config")
+	}
+	if rule.Match.Path != "" {
+		if _, err := path.Match(rule.Match.Path, "/"); err != nil {
+			return extractor{}, fmt.Errorf("match path %q: %w", rule.Match.Path, err)
+		}
+	}
+	x := extractor{match: rule.Match, source: rule.Extract.Source}
+	switch rule.Extract.Source {
+	case transform.SourceBody:
+		p, err := compilePath(rule.Extract.Path)
+		if err != nil {
+			return extractor{}, err
+		}
+		x.path = p
+	case transform.SourceHeader:
+		if rule.Extract.Header == "" {
+			return extractor{}, fmt.Errorf("header extraction names no header")
+		}
+		x.header = rule.Extract.Header
+	default:
+		return extractor{}, fmt.Errorf("extraction source %q", rule.Extract.Source)
+	}
+	if rule.Extract.Pattern != "" {
+		re, err := regexp.Compile(rule.Extract.Pattern)
+		if err != nil {
+			return extractor{}, fmt.Errorf("pattern %q: %w", rule.Extract.Pattern, err)
+		}
+		if re.NumSubexp() != 1 {
+			return extractor{}, fmt.Errorf("pattern %q must have exactly one group", rule.Extract.Pattern)
+		}
+		x.pattern = re
+	}
+	return x, nil
+}
+
+// NewSession starts the state of one replayed session.
+func (r *Rules) NewSession() *Session {
+	return &Session{rules: r, learned: &learned{values: map[string]string{}}}
+}
+
+// Message is a response as extraction rules see it.
+type Message struct {
+	Headers http.Header
+	Body    []byte
+}
+
+// Session maps values the captured responses of a session carried to the
+// ones the shadow target answered with. It is safe for concurrent use, but
+// a request only sees the values learned before it is applied.
+type Session struct {
+	rules *Rules
+
+	mu      sync.Mutex
+	learned *learned
+}
+
+// Learn runs the extraction rules matching t over the captured response and
+// the replayed one.
+func (s *Session) Learn(t traffic.CapturedTraffic, original, replayed Message) {
+	for _, x := range s.rules.extractors {
+		if !x.matches(t) {
+			continue
+		}
+		from, ok := x.extract(original)
+		if !ok {
+			continue
+		}
+		to, ok := x.extract(replayed)
+		if !ok || from == to {
+			continue
+		}
+		s.mu.Lock()
+		s.learned = s.learned.with(from, to)
+		s.mu.Unlock()
+	}
+}
+
+// Apply returns t and its request body with the learned values replaced
+// where they stand as whole tokens: path segments, query values, words of
+// header values, and string or number values of a JSON body. A form body is
+// treated like a query and any other body like a header; gRPC bodies are
+// binary and left alone.
+func (s *Session) Apply(t traffic.CapturedTraffic, body []byte) (traffic.CapturedTraffic, []byte) {
+	s.mu.Lock()
+	l := s.learned
+	s.mu.Unlock()
+	if len(l.values) == 0 {
+		return t, body
+	}
+	t.Request.Path = l.replacePath(t.Request.Path)
+	t.Request.QueryString = l.replaceQuery(t.Request.QueryString)
+	headers := make(http.Header, len(t.Request.Headers))
+	for name, values := range t.Request.Headers {
+		replaced := make([]string, len(values))
+		for i, v := range values {
+			replaced[i] = l.replaceWords(v)
+		}
+		headers[name] = replaced
+	}
+	t.Request.Headers = headers
+	switch {
+	case t.Protocol == traffic.ProtocolGRPC || len(body) == 0:
+	case json.Valid(body):
+		body = l.replaceJSON(body)
+	case isForm(t.Request.Headers):
+		body = []byte(l.replaceQuery(string(body)))
+	default:
+		body = []byte(l.replaceWords(string(body)))
+	}
+	return t, body
+}
+
+func isForm(h http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+func (x extractor) matches(t traffic.CapturedTraffic) bool {
+	if x.match.Method != "" && !strings.EqualFold(x.match.Method, t.Method) {
+		return false
+	}
+	if x.match.Path != "" {
+		ok, _ := path.Match(x.match.Path, t.Request.Path)
+		return ok
+	}
+	return true
 }
 
-func NewEngine(logger *observability.Logger) *Engine {
-	return &Engine{logger: logger}
+func (x extractor) extract(m Message) (string, bool) {
+	var value string
+	switch x.source {
+	case transform.SourceHeader:
+		value = m.Headers.Get(x.header)
+	case transform.SourceBody:
+		dec := json.NewDecoder(bytes.NewReader(m.Body))
+		dec.UseNumber()
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			return "", false
+		}
+		v, ok := x.path.lookup(doc)
+		if !ok {
+			return "", false
+		}
+		switch v := v.(type) {
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		default:
+			return "", false
+		}
+	}
+	if x.pattern != nil {
+		match := x.pattern.FindStringSubmatch(value)
+		if match == nil {
+			return "", false
+		}
+		value = match[1]
+	}
+	return value, value != ""
 }
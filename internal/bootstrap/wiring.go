@@ -3,16 +3,36 @@ package bootstrap
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
+	"synthema/internal/adapters/blobstore"
+	"synthema/internal/adapters/grpcwire"
+	"synthema/internal/adapters/postgres"
 	redisadapter "synthema/internal/adapters/redis"
+	"synthema/internal/app/capture"
+	"synthema/internal/app/diff"
+	"synthema/internal/app/export"
 	"synthema/internal/app/health"
+	"synthema/internal/app/importer"
+	"synthema/internal/app/ingest"
+	"synthema/internal/app/privacy"
+	"synthema/internal/app/replay"
+	"synthema/internal/app/transform"
 	"synthema/internal/config"
 	authctx "synthema/internal/context"
+	"synthema/internal/domain/traffic"
 	authhandlers "synthema/internal/handlers/auth"
+	replayhandlers "synthema/internal/handlers/replay"
+	traffichandlers "synthema/internal/handlers/traffic"
 	"synthema/internal/http"
 	"synthema/internal/middleware"
 	"synthema/internal/observability"
+	"synthema/internal/ports/queue"
+	"synthema/internal/ports/repository"
 	"synthema/internal/repositories"
 	"synthema/internal/routes"
 	"synthema/internal/service"
@@ -20,6 +40,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/redis/go-redis/v9"
 )
@@ -29,17 +50,27 @@ type APIApp struct {
 	Logger *observability.Logger
 	App    *fiber.App
 	DB     *sql.DB
+	Pool   *pgxpool.Pool
 	Redis  *redis.Client
 }
 
 type CaptureApp struct {
-	Config config.Config
-	Logger *observability.Logger
+	Config   config.Config
+	Logger   *observability.Logger
+	Service  *capture.Service
+	Policies *capture.PolicySource
+	Server   *capture.Server
+	Redis    *redis.Client
+	Pool     *pgxpool.Pool
 }
 
 type WorkerApp struct {
 	Config config.Config
 	Logger *observability.Logger
+	Ingest *ingest.Service
+	Replay *replay.Service
+	Pool   *pgxpool.Pool
+	Redis  *redis.Client
 }
 
 func BootstrapAPI() (APIApp, error) {
@@ -69,6 +100,28 @@ func BootstrapAPI() (APIApp, error) {
 		return APIApp{}, err
 	}
 
+	// The traffic adapters are built on pgx rather than database/sql.
+	pool, err := postgres.Connect(context.Background(), cfg.Postgres)
+	if err != nil {
+		_ = redisClient.Close()
+		_ = db.Close()
+		return APIApp{}, err
+	}
+	blobs, err := blobstore.New(cfg.Blob)
+	if err != nil {
+		pool.Close()
+		_ = redisClient.Close()
+		_ = db.Close()
+		return APIApp{}, err
+	}
+	trafficRepo := postgres.NewTrafficRepository(pool)
+	exporter := export.NewService(logger, trafficRepo, blobs)
+	diffRepo := postgres.NewDiffRepository(pool)
+	replayJobs := replay.NewService(logger, postgres.NewReplayRepository(pool), trafficRepo, diffRepo, replay.Options{
+		Transforms: transform.NewEngine(logger, postgres.NewTransformRepository(pool)),
+	})
+	diffs := diff.NewService(logger, diffRepo)
+
 	userRepo := repositories.NewUserRepository(db)
 	sessionRepo := repositories.NewSessionRepository(db)
 	authMW := middleware.Auth(userRepo, sessionRepo, cfg.Auth.CookieName)
@@ -135,7 +188,10 @@ func BootstrapAPI() (APIApp, error) {
 		return http.Success(c, fiber.StatusOK, http.MsgProtectedOK, fiber.Map{"user_id": userID})
 	})
 
-	return APIApp{Config: cfg, Logger: logger, App: app, DB: db, Redis: redisClient}, nil
+	routes.RegisterTrafficRoutes(api, traffichandlers.NewExportHandler(exporter))
+	routes.RegisterReplayRoutes(api, replayhandlers.NewJobHandler(replayJobs, diffs))
+
+	return APIApp{Config: cfg, Logger: logger, App: app, DB: db, Pool: pool, Redis: redisClient}, nil
 }
 
 func BootstrapCapture() (CaptureApp, error) {
@@ -144,7 +200,115 @@ func BootstrapCapture() (CaptureApp, error) {
 		return CaptureApp{}, err
 	}
 	logger := observability.NewLogger(cfg)
-	return CaptureApp{Config: cfg, Logger: logger}, nil
+
+	if cfg.Capture.UpstreamURL == "" {
+		return CaptureApp{}, errors.New("capture requires SYNTHEMA_CAPTURE_UPSTREAM_URL")
+	}
+	upstream, err := url.Parse(cfg.Capture.UpstreamURL)
+	if err != nil {
+		return CaptureApp{}, err
+	}
+	if upstream.Scheme == "" || upstream.Host == "" {
+		return CaptureApp{}, fmt.Errorf("invalid capture upstream url %q", cfg.Capture.UpstreamURL)
+	}
+	if cfg.Capture.ProjectID == "" || cfg.Capture.EnvironmentID == "" {
+		return CaptureApp{}, errors.New("capture requires SYNTHEMA_CAPTURE_PROJECT_ID and SYNTHEMA_CAPTURE_ENVIRONMENT_ID")
+	}
+	sessionKey, err := capture.ParseKeyExtractor(cfg.Capture.SessionKey)
+	if err != nil {
+		return CaptureApp{}, err
+	}
+
+	fingerprinter, err := newFingerprinter(cfg)
+	if err != nil {
+		return CaptureApp{}, err
+	}
+	hasher, err := newHasher(cfg, logger)
+	if err != nil {
+		return CaptureApp{}, err
+	}
+
+	ctx := context.Background()
+
+	var (
+		redisClient  *redis.Client
+		pool         *pgxpool.Pool
+		trafficQueue queue.TrafficQueue
+		trafficRepo  repository.TrafficRepository
+		policyRepo   repository.CapturePolicyRepository
+	)
+	if cfg.Postgres.DSN != "" {
+		pool, err = postgres.Connect(ctx, cfg.Postgres)
+		if err != nil {
+			return CaptureApp{}, err
+		}
+		policyRepo = postgres.NewCapturePolicyRepository(pool)
+	}
+	if cfg.Redis.Addr != "" {
+		redisClient, err = redisadapter.NewClient(cfg.Redis)
+		if err != nil {
+			_ = postgres.Close(pool)
+			return CaptureApp{}, err
+		}
+		if err := redisadapter.Ping(ctx, redisClient, cfg.Redis.DialTimeout); err != nil {
+			_ = redisClient.Close()
+			_ = postgres.Close(pool)
+			return CaptureApp{}, err
+		}
+		stream, err := redisadapter.NewTrafficStream(redisClient, cfg.TrafficStream)
+		if err != nil {
+			_ = redisClient.Close()
+			_ = postgres.Close(pool)
+			return CaptureApp{}, err
+		}
+		trafficQueue = stream
+	} else if pool != nil {
+		// Without a queue, write straight to Postgres.
+		trafficRepo = postgres.NewTrafficRepository(pool)
+	}
+
+	blobs, err := blobstore.New(cfg.Blob)
+	if err != nil {
+		if redisClient != nil {
+			_ = redisClient.Close()
+		}
+		_ = postgres.Close(pool)
+		return CaptureApp{}, err
+	}
+	if blobs == nil {
+		logger.Warn("no blob store configured (SYNTHEMA_BLOB_BACKEND); only body hashes will be kept")
+	}
+
+	policies := capture.NewPolicySource(logger, policyRepo, cfg.Capture.EnvironmentID, cfg.Capture.ShadowTargetID, cfg.Capture.PolicyRefresh)
+	if err := policies.Load(ctx); err != nil {
+		if redisClient != nil {
+			_ = redisClient.Close()
+		}
+		_ = postgres.Close(pool)
+		return CaptureApp{}, fmt.Errorf("load capture policy: %w", err)
+	}
+
+	captureService := capture.NewServiceWithOptions(logger, trafficRepo, trafficQueue, capture.ServiceOptions{
+		ProjectID:          cfg.Capture.ProjectID,
+		EnvironmentID:      cfg.Capture.EnvironmentID,
+		ShadowTargetID:     cfg.Capture.ShadowTargetID,
+		BufferSize:         cfg.Capture.BufferSize,
+		SessionIdleTimeout: cfg.Capture.SessionIdleTimeout,
+		Blobs:              blobs,
+		Fingerprinter:      fingerprinter,
+		DedupWindow:        cfg.Capture.DedupWindow,
+		Hasher:             hasher,
+		ScrubHeaders:       cfg.Capture.ScrubHeaders,
+	})
+	interceptor := capture.NewInterceptor(logger, upstream, captureService, capture.InterceptorOptions{
+		MaxBodyBytes:  cfg.Capture.MaxBodyBytes,
+		SessionKey:    sessionKey,
+		Policies:      policies,
+		UpstreamHTTP2: cfg.Capture.HTTP2,
+	})
+	server := capture.NewServer(cfg, logger, interceptor)
+
+	return CaptureApp{Config: cfg, Logger: logger, Service: captureService, Policies: policies, Server: server, Redis: redisClient, Pool: pool}, nil
 }
 
 func BootstrapWorker() (WorkerApp, error) {
@@ -153,5 +317,203 @@ func BootstrapWorker() (WorkerApp, error) {
 		return WorkerApp{}, err
 	}
 	logger := observability.NewLogger(cfg)
-	return WorkerApp{Config: cfg, Logger: logger}, nil
+
+	if cfg.Postgres.DSN == "" {
+		return WorkerApp{}, postgres.ErrPostgresNotConfigured
+	}
+	ctx := context.Background()
+
+	pool, err := postgres.Connect(ctx, cfg.Postgres)
+	if err != nil {
+		return WorkerApp{}, err
+	}
+
+	redisClient, err := redisadapter.NewClient(cfg.Redis)
+	if err != nil {
+		pool.Close()
+		return WorkerApp{}, err
+	}
+	if err := redisadapter.Ping(ctx, redisClient, cfg.Redis.DialTimeout); err != nil {
+		_ = redisClient.Close()
+		pool.Close()
+		return WorkerApp{}, err
+	}
+
+	stream, err := redisadapter.NewTrafficStream(redisClient, cfg.TrafficStream)
+	if err != nil {
+		_ = redisClient.Close()
+		pool.Close()
+		return WorkerApp{}, err
+	}
+	if err := stream.EnsureGroup(ctx); err != nil {
+		_ = redisClient.Close()
+		pool.Close()
+		return WorkerApp{}, err
+	}
+
+	trafficRepo := postgres.NewTrafficRepository(pool)
+	ingestService := ingest.NewService(logger, stream, trafficRepo, ingest.Options{
+		Concurrency:   cfg.Worker.Concurrency,
+		BatchSize:     cfg.Worker.BatchSize,
+		FlushInterval: cfg.Worker.FlushInterval,
+		FlushTimeout:  cfg.ShutdownGracePeriod,
+
+		SessionIdleTimeout: cfg.Capture.SessionIdleTimeout,
+	})
+
+	replayService, err := newReplayService(cfg, logger, pool, trafficRepo)
+	if err != nil {
+		_ = redisClient.Close()
+		pool.Close()
+		return WorkerApp{}, err
+	}
+
+	return WorkerApp{Config: cfg, Logger: logger, Ingest: ingestService, Replay: replayService, Pool: pool, Redis: redisClient}, nil
+}
+
+func newReplayService(cfg config.Config, logger *observability.Logger, pool *pgxpool.Pool, trafficRepo repository.TrafficRepository) (*replay.Service, error) {
+	blobs, err := blobstore.New(cfg.Blob)
+	if err != nil {
+		return nil, err
+	}
+	fingerprinter, err := newFingerprinter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var descriptors *grpcwire.Descriptors
+	if cfg.GRPC.DescriptorSet != "" {
+		if descriptors, err = grpcwire.LoadDescriptorSet(cfg.GRPC.DescriptorSet); err != nil {
+			return nil, fmt.Errorf("load grpc descriptor set: %w", err)
+		}
+	}
+	return replay.NewService(logger, postgres.NewReplayRepository(pool), trafficRepo, postgres.NewDiffRepository(pool), replay.Options{
+		Concurrency:   cfg.Replay.Concurrency,
+		PollInterval:  cfg.Replay.PollInterval,
+		WorkerID:      cfg.TrafficStream.Consumer,
+		Lease:         cfg.Replay.Lease,
+		MaxAttempts:   cfg.Replay.MaxAttempts,
+		ScheduleGrace: cfg.Replay.ScheduleGrace,
+		Sender:        replay.NewSender(cfg.Replay.RequestTimeout, cfg.Capture.MaxBodyBytes, cfg.Replay.AllowedHosts),
+		Comparer:      diff.NewComparer(descriptors),
+		Blobs:         blobs,
+		Fingerprinter: fingerprinter,
+		Transforms:    transform.NewEngine(logger, postgres.NewTransformRepository(pool)),
+	}), nil
+}
+
+type ImportApp struct {
+	Config   config.Config
+	Logger   *observability.Logger
+	Importer *importer.Service
+	Pool     *pgxpool.Pool
+}
+
+// BootstrapImport wires the offline importers. They write straight to
+// Postgres into the project and environment configured for capture.
+func BootstrapImport() (ImportApp, error) {
+	cfg, err := config.LoadFromEnv()
+	if err != nil {
+		return ImportApp{}, err
+	}
+	logger := observability.NewLogger(cfg)
+
+	if cfg.Postgres.DSN == "" {
+		return ImportApp{}, postgres.ErrPostgresNotConfigured
+	}
+	if cfg.Capture.ProjectID == "" || cfg.Capture.EnvironmentID == "" {
+		return ImportApp{}, errors.New("import requires SYNTHEMA_CAPTURE_PROJECT_ID and SYNTHEMA_CAPTURE_ENVIRONMENT_ID")
+	}
+	fingerprinter, err := newFingerprinter(cfg)
+	if err != nil {
+		return ImportApp{}, err
+	}
+	hasher, err := newHasher(cfg, logger)
+	if err != nil {
+		return ImportApp{}, err
+	}
+	blobs, err := blobstore.New(cfg.Blob)
+	if err != nil {
+		return ImportApp{}, err
+	}
+
+	pool, err := postgres.Connect(context.Background(), cfg.Postgres)
+	if err != nil {
+		return ImportApp{}, err
+	}
+
+	importService := importer.NewService(logger, postgres.NewTrafficRepository(pool), importer.Options{
+		ProjectID:      cfg.Capture.ProjectID,
+		EnvironmentID:  cfg.Capture.EnvironmentID,
+		ShadowTargetID: cfg.Capture.ShadowTargetID,
+		MaxBodyBytes:   cfg.Capture.MaxBodyBytes,
+		BatchSize:      cfg.Worker.BatchSize,
+		Fingerprinter:  fingerprinter,
+		Sanitizer:      privacy.NewSanitizer(hasher, cfg.Capture.ScrubHeaders),
+		Blobs:          blobs,
+	})
+
+	return ImportApp{Config: cfg, Logger: logger, Importer: importService, Pool: pool}, nil
+}
+
+type ExportApp struct {
+	Config   config.Config
+	Logger   *observability.Logger
+	Exporter *export.Service
+	Pool     *pgxpool.Pool
+}
+
+func BootstrapExport() (ExportApp, error) {
+	cfg, err := config.LoadFromEnv()
+	if err != nil {
+		return ExportApp{}, err
+	}
+	logger := observability.NewLogger(cfg)
+
+	if cfg.Postgres.DSN == "" {
+		return ExportApp{}, postgres.ErrPostgresNotConfigured
+	}
+	blobs, err := blobstore.New(cfg.Blob)
+	if err != nil {
+		return ExportApp{}, err
+	}
+	pool, err := postgres.Connect(context.Background(), cfg.Postgres)
+	if err != nil {
+		return ExportApp{}, err
+	}
+
+	exporter := export.NewService(logger, postgres.NewTrafficRepository(pool), blobs)
+	return ExportApp{Config: cfg, Logger: logger, Exporter: exporter, Pool: pool}, nil
+}
+
+func newFingerprinter(cfg config.Config) (*traffic.Fingerprinter, error) {
+	return traffic.NewFingerprinter(traffic.FingerprintOptions{
+		Headers:          cfg.Fingerprint.Headers,
+		IgnoreQueryKeys:  cfg.Fingerprint.IgnoreQueryKeys,
+		VolatileSegments: cfg.Fingerprint.VolatileSegments,
+	})
+}
+
+// newHasher returns nil when no keys are configured, which production
+// refuses.
+func newHasher(cfg config.Config, logger *observability.Logger) (*privacy.Hasher, error) {
+	hashKey, ok, err := privacy.ParseHashKey(cfg.Capture.IPHashKey)
+	if err != nil {
+		return nil, fmt.Errorf("SYNTHEMA_CAPTURE_IP_HASH_KEY: %w", err)
+	}
+	if ok {
+		return privacy.NewHasher(hashKey)
+	}
+	if isProduction(cfg.Environment) {
+		return nil, errors.New("capture in production requires SYNTHEMA_CAPTURE_IP_HASH_KEY")
+	}
+	logger.Warn("no ip hash key configured (SYNTHEMA_CAPTURE_IP_HASH_KEY); client ips and session keys will be discarded")
+	return nil, nil
+}
+
+func isProduction(env string) bool {
+	switch strings.ToLower(env) {
+	case "prod", "production":
+		return true
+	}
+	return false
 }
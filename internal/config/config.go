@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,11 +13,19 @@ type Config struct {
 	Environment string
 	LogLevel    string
 
-	API  APIConfig
-	Auth AuthConfig
+	API         APIConfig
+	Auth        AuthConfig
+	Capture     CaptureConfig
+	Worker      WorkerConfig
+	Replay      ReplayConfig
+	Fingerprint FingerprintConfig
+	Import      ImportConfig
+	GRPC        GRPCConfig
 
-	Postgres PostgresConfig
-	Redis    RedisConfig
+	Postgres      PostgresConfig
+	Redis         RedisConfig
+	TrafficStream TrafficStreamConfig
+	Blob          BlobConfig
 
 	ShutdownGracePeriod time.Duration
 }
@@ -26,6 +35,79 @@ type APIConfig struct {
 	Port int
 }
 
+type CaptureConfig struct {
+	Host         string
+	Port         int
+	UpstreamURL  string
+	BufferSize   int
+	MaxBodyBytes int64
+
+	ProjectID      string
+	EnvironmentID  string
+	ShadowTargetID string
+	PolicyRefresh  time.Duration
+
+	SessionKey         string
+	SessionIdleTimeout time.Duration
+
+	DedupWindow time.Duration
+
+	// IPHashKey is the active "id:secret" HMAC key for client IPs and
+	// session keys. Rotating it is a cut-over; see privacy.HashKey.
+	IPHashKey    string
+	ScrubHeaders []string
+
+	// HTTP2 accepts h2c from clients and speaks HTTP/2 to the upstream,
+	// for capturing gRPC.
+	HTTP2 bool
+}
+
+type WorkerConfig struct {
+	Concurrency   int
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// ReplayConfig sizes the replay engine that runs inside the worker.
+type ReplayConfig struct {
+	Concurrency    int
+	PollInterval   time.Duration
+	RequestTimeout time.Duration
+	// Lease is how long a claimed task stays with a worker that stops
+	// renewing it; MaxAttempts caps how often a task is claimed when its
+	// shadow target's retry policy sets no limit.
+	Lease       time.Duration
+	MaxAttempts int
+	// AllowedHosts are the only hosts replay sends to; empty allows none.
+	// "*.example.com" allows example.com and the hosts below it.
+	AllowedHosts []string
+	// ScheduleGrace is how late a schedule's run may still start a job,
+	// e.g. after the workers were down.
+	ScheduleGrace time.Duration
+}
+
+type FingerprintConfig struct {
+	Headers          []string
+	IgnoreQueryKeys  []string
+	VolatileSegments []string
+}
+
+// ImportConfig holds defaults for access log imports; the import command
+// can override each of them.
+type ImportConfig struct {
+	LogFormat  string
+	LogPattern string
+	SessionKey string
+	Host       string
+	Scheme     string
+}
+
+type GRPCConfig struct {
+	// DescriptorSet is a FileDescriptorSet (protoc --descriptor_set_out
+	// --include_imports) used to decode gRPC messages when diffing.
+	DescriptorSet string
+}
+
 type AuthConfig struct {
 	SessionTTL     time.Duration
 	CookieName     string
@@ -50,6 +132,29 @@ type RedisConfig struct {
 	WriteTimeout time.Duration
 }
 
+type TrafficStreamConfig struct {
+	Stream           string
+	Group            string
+	Consumer         string
+	MaxLen           int64
+	ClaimMinIdle     time.Duration
+	MaxDeliveries    int64
+	DeadLetterStream string
+}
+
+type BlobConfig struct {
+	Backend string
+	FSRoot  string
+
+	S3Endpoint  string
+	S3Bucket    string
+	S3Region    string
+	S3Prefix    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+}
+
 func LoadFromEnv() (Config, error) {
 	if err := loadDotEnvIfPresent(".env"); err != nil {
 		return Config{}, err
@@ -64,6 +169,143 @@ func LoadFromEnv() (Config, error) {
 		port = p
 	}
 
+	capturePort := 8090
+	if v := os.Getenv("SYNTHEMA_CAPTURE_PORT"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, err
+		}
+		capturePort = p
+	}
+
+	captureBufferSize := 4096
+	if v := os.Getenv("SYNTHEMA_CAPTURE_BUFFER_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, err
+		}
+		captureBufferSize = n
+	}
+
+	captureMaxBodyBytes := int64(1 << 20)
+	if v := os.Getenv("SYNTHEMA_CAPTURE_MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return Config{}, err
+		}
+		captureMaxBodyBytes = n
+	}
+
+	sessionIdleTimeout := 30 * time.Minute
+	if v := os.Getenv("SYNTHEMA_CAPTURE_SESSION_IDLE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, err
+		}
+		sessionIdleTimeout = d
+	}
+
+	policyRefresh := 30 * time.Second
+	if v := os.Getenv("SYNTHEMA_CAPTURE_POLICY_REFRESH"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, err
+		}
+		policyRefresh = d
+	}
+
+	captureHTTP2 := false
+	if v := os.Getenv("SYNTHEMA_CAPTURE_HTTP2"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, err
+		}
+		captureHTTP2 = b
+	}
+
+	var dedupWindow time.Duration
+	if v := os.Getenv("SYNTHEMA_CAPTURE_DEDUP_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, err
+		}
+		dedupWindow = d
+	}
+
+	workerConcurrency := 4
+	if v := os.Getenv("SYNTHEMA_WORKER_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, err
+		}
+		workerConcurrency = n
+	}
+	workerBatchSize := 500
+	if v := os.Getenv("SYNTHEMA_WORKER_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, err
+		}
+		workerBatchSize = n
+	}
+	workerFlushInterval := time.Second
+	if v := os.Getenv("SYNTHEMA_WORKER_FLUSH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, err
+		}
+		workerFlushInterval = d
+	}
+
+	replayConcurrency := 4
+	if v := os.Getenv("SYNTHEMA_REPLAY_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, err
+		}
+		replayConcurrency = n
+	}
+	replayPollInterval := 2 * time.Second
+	if v := os.Getenv("SYNTHEMA_REPLAY_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, err
+		}
+		replayPollInterval = d
+	}
+	replayRequestTimeout := 30 * time.Second
+	if v := os.Getenv("SYNTHEMA_REPLAY_REQUEST_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, err
+		}
+		replayRequestTimeout = d
+	}
+	replayLease := 30 * time.Second
+	if v := os.Getenv("SYNTHEMA_REPLAY_LEASE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, err
+		}
+		replayLease = d
+	}
+	replayMaxAttempts := 3
+	if v := os.Getenv("SYNTHEMA_REPLAY_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, err
+		}
+		replayMaxAttempts = n
+	}
+	replayScheduleGrace := time.Hour
+	if v := os.Getenv("SYNTHEMA_REPLAY_SCHEDULE_GRACE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, err
+		}
+		replayScheduleGrace = d
+	}
+
 	dsn := os.Getenv("SYNTHEMA_POSTGRES_DSN")
 	if dsn == "" {
 		dsn = os.Getenv("DATABASE_URL")
@@ -126,6 +368,62 @@ func LoadFromEnv() (Config, error) {
 		}
 	}
 
+	streamMaxLen := int64(100000)
+	if v := os.Getenv("SYNTHEMA_TRAFFIC_STREAM_MAXLEN"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return Config{}, err
+		}
+		streamMaxLen = n
+	}
+	streamClaimMinIdle := time.Minute
+	if v := os.Getenv("SYNTHEMA_TRAFFIC_STREAM_CLAIM_IDLE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, err
+		}
+		streamClaimMinIdle = d
+	}
+	streamMaxDeliveries := int64(5)
+	if v := os.Getenv("SYNTHEMA_TRAFFIC_STREAM_MAX_DELIVERIES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return Config{}, err
+		}
+		streamMaxDeliveries = n
+	}
+	streamName := getenvDefault("SYNTHEMA_TRAFFIC_STREAM", "synthema:traffic")
+	streamConsumer := os.Getenv("SYNTHEMA_TRAFFIC_STREAM_CONSUMER")
+	if streamConsumer == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return Config{}, err
+		}
+		streamConsumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	blobPathStyle := true
+	if v := os.Getenv("SYNTHEMA_BLOB_S3_PATH_STYLE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, err
+		}
+		blobPathStyle = b
+	}
+
+	if os.Getenv("SYNTHEMA_CAPTURE_IP_HASH_KEYS") != "" {
+		return Config{}, fmt.Errorf("SYNTHEMA_CAPTURE_IP_HASH_KEYS is replaced by SYNTHEMA_CAPTURE_IP_HASH_KEY, which takes only the active key")
+	}
+
+	// Wildcards only stand for whole labels: "*.example.com", never "*" or
+	// "*example.com", which would let lookalike hosts through.
+	replayAllowedHosts := getenvList("SYNTHEMA_REPLAY_ALLOWED_HOSTS", "")
+	for _, h := range replayAllowedHosts {
+		if domain, ok := strings.CutPrefix(h, "*."); (ok && (domain == "" || strings.Contains(domain, "*"))) || (!ok && strings.Contains(h, "*")) {
+			return Config{}, fmt.Errorf("SYNTHEMA_REPLAY_ALLOWED_HOSTS: %q must be a host name or *.domain", h)
+		}
+	}
+
 	grace := 10 * time.Second
 	if v := os.Getenv("SYNTHEMA_SHUTDOWN_GRACE"); v != "" {
 		d, err := time.ParseDuration(v)
@@ -177,8 +475,77 @@ func LoadFromEnv() (Config, error) {
 			CookieSameSite: cookieSameSite,
 			CookieDomain:   cookieDomain,
 		},
-		Postgres:            PostgresConfig{DSN: dsn},
-		Redis:               redisCfg,
+		Capture: CaptureConfig{
+			Host:         getenvDefault("SYNTHEMA_CAPTURE_HOST", "0.0.0.0"),
+			Port:         capturePort,
+			UpstreamURL:  os.Getenv("SYNTHEMA_CAPTURE_UPSTREAM_URL"),
+			BufferSize:   captureBufferSize,
+			MaxBodyBytes: captureMaxBodyBytes,
+
+			ProjectID:      os.Getenv("SYNTHEMA_CAPTURE_PROJECT_ID"),
+			EnvironmentID:  os.Getenv("SYNTHEMA_CAPTURE_ENVIRONMENT_ID"),
+			ShadowTargetID: os.Getenv("SYNTHEMA_CAPTURE_SHADOW_TARGET_ID"),
+			PolicyRefresh:  policyRefresh,
+
+			SessionKey:         getenvDefault("SYNTHEMA_CAPTURE_SESSION_KEY", "client_ip"),
+			SessionIdleTimeout: sessionIdleTimeout,
+
+			DedupWindow: dedupWindow,
+
+			IPHashKey:    os.Getenv("SYNTHEMA_CAPTURE_IP_HASH_KEY"),
+			ScrubHeaders: getenvList("SYNTHEMA_CAPTURE_SCRUB_HEADERS", ""),
+
+			HTTP2: captureHTTP2,
+		},
+		Worker: WorkerConfig{
+			Concurrency:   workerConcurrency,
+			BatchSize:     workerBatchSize,
+			FlushInterval: workerFlushInterval,
+		},
+		Replay: ReplayConfig{
+			Concurrency:    replayConcurrency,
+			PollInterval:   replayPollInterval,
+			RequestTimeout: replayRequestTimeout,
+			Lease:          replayLease,
+			MaxAttempts:    replayMaxAttempts,
+			AllowedHosts:   replayAllowedHosts,
+			ScheduleGrace:  replayScheduleGrace,
+		},
+		Fingerprint: FingerprintConfig{
+			Headers:          getenvList("SYNTHEMA_FINGERPRINT_HEADERS", "Accept,Content-Type"),
+			IgnoreQueryKeys:  getenvList("SYNTHEMA_FINGERPRINT_IGNORE_QUERY", "_,cb,ts,timestamp,nonce"),
+			VolatileSegments: getenvList("SYNTHEMA_FINGERPRINT_VOLATILE_SEGMENTS", ""),
+		},
+		Import: ImportConfig{
+			LogFormat:  getenvDefault("SYNTHEMA_IMPORT_LOG_FORMAT", "nginx"),
+			LogPattern: os.Getenv("SYNTHEMA_IMPORT_LOG_PATTERN"),
+			SessionKey: getenvDefault("SYNTHEMA_IMPORT_SESSION_KEY", "client_ip"),
+			Host:       os.Getenv("SYNTHEMA_IMPORT_HOST"),
+			Scheme:     getenvDefault("SYNTHEMA_IMPORT_SCHEME", "http"),
+		},
+		GRPC:     GRPCConfig{DescriptorSet: os.Getenv("SYNTHEMA_GRPC_DESCRIPTOR_SET")},
+		Postgres: PostgresConfig{DSN: dsn},
+		Redis:    redisCfg,
+		TrafficStream: TrafficStreamConfig{
+			Stream:           streamName,
+			Group:            getenvDefault("SYNTHEMA_TRAFFIC_STREAM_GROUP", "synthema-worker"),
+			Consumer:         streamConsumer,
+			MaxLen:           streamMaxLen,
+			ClaimMinIdle:     streamClaimMinIdle,
+			MaxDeliveries:    streamMaxDeliveries,
+			DeadLetterStream: getenvDefault("SYNTHEMA_TRAFFIC_STREAM_DEAD_LETTER", streamName+":dead"),
+		},
+		Blob: BlobConfig{
+			Backend:     os.Getenv("SYNTHEMA_BLOB_BACKEND"),
+			FSRoot:      getenvDefault("SYNTHEMA_BLOB_FS_ROOT", "data/blobs"),
+			S3Endpoint:  os.Getenv("SYNTHEMA_BLOB_S3_ENDPOINT"),
+			S3Bucket:    os.Getenv("SYNTHEMA_BLOB_S3_BUCKET"),
+			S3Region:    os.Getenv("SYNTHEMA_BLOB_S3_REGION"),
+			S3Prefix:    getenvDefault("SYNTHEMA_BLOB_S3_PREFIX", "bodies"),
+			S3AccessKey: os.Getenv("SYNTHEMA_BLOB_S3_ACCESS_KEY"),
+			S3SecretKey: os.Getenv("SYNTHEMA_BLOB_S3_SECRET_KEY"),
+			S3PathStyle: blobPathStyle,
+		},
 		ShutdownGracePeriod: grace,
 	}
 
@@ -191,3 +558,14 @@ func getenvDefault(key, def string) string {
 	}
 	return def
 }
+
+// getenvList splits a comma-separated variable, dropping empty items.
+func getenvList(key, def string) []string {
+	var out []string
+	for _, item := range strings.Split(getenvDefault(key, def), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
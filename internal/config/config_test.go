@@ -0,0 +1,23 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadFromEnvRejectsLooseReplayWildcards(t *testing.T) {
+	for _, hosts := range []string{"*", "*example.com", "*.", "shadow.*.example.com"} {
+		t.Setenv("SYNTHEMA_REPLAY_ALLOWED_HOSTS", hosts)
+		if _, err := LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "SYNTHEMA_REPLAY_ALLOWED_HOSTS") {
+			t.Errorf("allowlist %q: err = %v, want it rejected", hosts, err)
+		}
+	}
+	t.Setenv("SYNTHEMA_REPLAY_ALLOWED_HOSTS", "shadow.internal,*.shadow.example.com")
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cfg.Replay.AllowedHosts, ","); got != "shadow.internal,*.shadow.example.com" {
+		t.Errorf("AllowedHosts = %s", got)
+	}
+}
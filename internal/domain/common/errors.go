@@ -5,4 +5,7 @@ import "errors"
 var (
 	ErrNotFound     = errors.New("not found")
 	ErrInvalidInput = errors.New("invalid input")
+	// ErrConflict means the resource is in a state that does not allow the
+	// change.
+	ErrConflict = errors.New("conflict")
 )
@@ -8,8 +8,72 @@ import (
 
 type DiffID string
 
+// Status mirrors the diff_results status column.
+type Status string
+
+const (
+	StatusMatched    Status = "matched"
+	StatusMismatched Status = "mismatched"
+	StatusError      Status = "error"
+	StatusSkipped    Status = "skipped"
+)
+
+// StrategyNoiseAware, as a shadow target's diff_strategy, leaves out of a
+// three-way diff the paths where the two baselines differed. Other
+// strategies report them as changes.
+const StrategyNoiseAware = "noise_aware"
+
+// DiffResult is a diff_results row comparing one replayed request with
+// its capture, or in a three-way replay with the first baseline. Noise lists
+// the paths the baselines disagreed on for the endpoint so far.
 type DiffResult struct {
-	ID        DiffID
-	ReplayID  replay.ReplayID
-	CreatedAt time.Time
+	ID             DiffID
+	ReplayResultID replay.ResultID
+	CreatedAt      time.Time
+	Status         Status
+	Strategy       string
+	Changes        []Change
+	Noise          []string
+	ErrorMessage   string
+
+	// Fingerprint and Endpoint identify the original request's endpoint so
+	// results can be grouped; see traffic.Fingerprinter.
+	Fingerprint string
+	Endpoint    string
+}
+
+// EndpointSummary counts diff outcomes for one request fingerprint.
+type EndpointSummary struct {
+	Fingerprint string
+	Endpoint    string
+	Total       int
+	Matched     int
+	Mismatched  int
+	Errored     int
+	Skipped     int
+}
+
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// Change is one difference between the original and the replayed response.
+// Path is "status", "grpc.status", "body" or a path into a decoded body
+// such as "body.items[2].id".
+type Change struct {
+	Path     string     `json:"path"`
+	Kind     ChangeKind `json:"kind"`
+	Original any        `json:"original,omitempty"`
+	Replayed any        `json:"replayed,omitempty"`
+}
+
+// Comparison is the outcome of diffing one replayed request. HTTP and gRPC
+// exchanges produce the same shape.
+type Comparison struct {
+	Status  Status   `json:"status"`
+	Changes []Change `json:"changes,omitempty"`
 }
@@ -1,15 +1,303 @@
 package replay
 
 import (
+	"errors"
 	"time"
 
 	"synthema/internal/domain/traffic"
 )
 
+// ErrLeaseLost means a worker no longer holds the lease on a task, which
+// has been handed to another worker or given up.
+var ErrLeaseLost = errors.New("replay task lease lost")
+
 type ReplayID string
 
+type TaskID string
+
+type ResultID string
+
+// Status mirrors the status columns of replay_jobs and replay_tasks. Only
+// jobs are paused; their unfinished tasks wait as queued.
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusPaused    Status = "paused"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Done reports whether the status is final.
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled
+}
+
+type TaskType string
+
+const (
+	// TaskSession replays one traffic session in sequence order.
+	TaskSession TaskType = "session"
+	// TaskBatch replays several sessions, one after the other.
+	TaskBatch TaskType = "batch"
+	// TaskLoad replays the sessions of a load job in a loop.
+	TaskLoad TaskType = "load"
+)
+
+// Mode says what a job replays for.
+type Mode string
+
+const (
+	// ModeShadow replays each selected session once and diffs every
+	// response against the captured one.
+	ModeShadow Mode = "shadow"
+	// ModeLoad loops over the selected sessions at a target request rate
+	// and records latency percentiles instead of diffs.
+	ModeLoad Mode = "load"
+)
+
+// Speed says how fast a job replays the requests of each session.
+type Speed string
+
+const (
+	// SpeedRealTime keeps the gaps between requests as they were captured.
+	SpeedRealTime Speed = "realtime"
+	// SpeedAccelerated divides the captured gaps by JobParams.SpeedFactor.
+	SpeedAccelerated Speed = "accelerated"
+	// SpeedMax sends requests as fast as the target answers them, at most
+	// JobParams.MaxInFlight at once.
+	SpeedMax Speed = "max"
+)
+
+// ResultStatus mirrors the replay_results status column.
+type ResultStatus string
+
+const (
+	ResultSucceeded ResultStatus = "succeeded"
+	ResultFailed    ResultStatus = "failed"
+	ResultSkipped   ResultStatus = "skipped"
+)
+
+// ReplayJob is a replay_jobs row: replay a selection of captured sessions
+// against a shadow target. Summary is set once a load job has run. Jobs a
+// schedule started name it and the run they are for.
 type ReplayJob struct {
-	ID        ReplayID
-	CaptureID traffic.CaptureID
-	CreatedAt time.Time
+	ID                 ReplayID
+	ProjectID          string
+	ShadowTargetID     string
+	TransformRuleSetID string
+	Status             Status
+	Params             JobParams
+	ErrorMessage       string
+	Summary            *JobSummary
+	ScheduleName       string
+	ScheduledFor       *time.Time
+	CreatedAt          time.Time
+	RequestedAt        time.Time
+	StartedAt          *time.Time
+	FinishedAt         *time.Time
+}
+
+// JobParams is stored in replay_jobs.params. Sessions are picked from the
+// shadow target's source environment: the listed ones, or else those that
+// started within [From, To).
+type JobParams struct {
+	SessionIDs []traffic.SessionID `json:"session_ids,omitempty"`
+	From       *time.Time          `json:"from,omitempty"`
+	To         *time.Time          `json:"to,omitempty"`
+	// Limit caps the number of sessions; zero means all.
+	Limit int `json:"limit,omitempty"`
+	// TaskType defaults to TaskSession. With TaskBatch, BatchSize sessions
+	// go into each task.
+	TaskType  TaskType `json:"task_type,omitempty"`
+	BatchSize int      `json:"batch_size,omitempty"`
+	// Speed defaults to SpeedMax. SpeedFactor is required with
+	// SpeedAccelerated, e.g. 2 or 10; MaxInFlight defaults to one request at
+	// a time, which keeps each session in order.
+	Speed       Speed   `json:"speed,omitempty"`
+	SpeedFactor float64 `json:"speed_factor,omitempty"`
+	MaxInFlight int     `json:"max_in_flight,omitempty"`
+	// Mode defaults to ModeShadow. Load is required with ModeLoad.
+	Mode Mode        `json:"mode,omitempty"`
+	Load *LoadParams `json:"load,omitempty"`
+}
+
+// LoadParams shapes a load job. The request rate climbs linearly from zero
+// to TargetRPS over RampUpSeconds, then holds until DurationSeconds have
+// passed since the start.
+type LoadParams struct {
+	TargetRPS       float64 `json:"target_rps"`
+	RampUpSeconds   int     `json:"ramp_up_seconds,omitempty"`
+	DurationSeconds int     `json:"duration_seconds"`
+}
+
+// JobSummary is what a load job measured, stored in replay_jobs.summary.
+// Latencies of requests that got no response are left out.
+type JobSummary struct {
+	Requests     int            `json:"requests"`
+	Errors       int            `json:"errors"`
+	ErrorClasses map[string]int `json:"error_classes,omitempty"`
+	StatusCodes  map[string]int `json:"status_codes,omitempty"`
+	DurationMS   int64          `json:"duration_ms"`
+	AchievedRPS  float64        `json:"achieved_rps"`
+	LatencyMS    Percentiles    `json:"latency_ms"`
+}
+
+type Percentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// Task is a replay_tasks row. A session task has SessionIDs of length one;
+// a batch task lists its sessions in metadata. A running task is leased to
+// one worker, which must renew the lease before LeaseExpiresAt.
+type Task struct {
+	ID             TaskID
+	JobID          ReplayID
+	Type           TaskType
+	SessionIDs     []traffic.SessionID
+	BatchKey       string
+	Status         Status
+	Attempt        int
+	ErrorMessage   string
+	LeaseOwner     string
+	LeaseExpiresAt *time.Time
+	// ScheduledAt holds a task back until then; it is set when a failed
+	// task is retried.
+	ScheduledAt *time.Time
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+}
+
+// ExpiredTask is a task taken back from a worker whose lease ran out:
+// queued again, or failed once it used up its attempts.
+type ExpiredTask struct {
+	ID     TaskID
+	JobID  ReplayID
+	Status Status
 }
+
+// TaskAttempt is a replay_task_attempts row: how one attempt at a task
+// ended. Attempts interrupted by shutdown or a pause are not recorded.
+type TaskAttempt struct {
+	TaskID       TaskID
+	Attempt      int
+	Status       Status
+	Worker       string
+	ErrorMessage string
+	StartedAt    *time.Time
+	FinishedAt   time.Time
+}
+
+// Result is a replay_results row: the shadow target's answer to one
+// captured request.
+type Result struct {
+	ID               ResultID
+	TaskID           TaskID
+	TrafficRequestID traffic.CaptureID
+	// Attempt is the attempt of the task that produced the result.
+	Attempt      int
+	Status       ResultStatus
+	StatusCode   int
+	Latency      time.Duration
+	ResponseSize int64
+	ResponseHash string
+	ErrorClass   string
+	ErrorMessage string
+	FinishedAt   time.Time
+}
+
+// MutationPolicy says what replay does with requests that may change state
+// on the target: POST, PUT, PATCH and DELETE, which includes all gRPC calls.
+type MutationPolicy string
+
+const (
+	// MutationsSkip records such requests as skipped without sending them.
+	MutationsSkip MutationPolicy = "skip"
+	// MutationsDryRun records the request that would have been sent.
+	MutationsDryRun MutationPolicy = "dry_run"
+	MutationsAllow  MutationPolicy = "allow"
+)
+
+// Policy is the replay_policy object in shadow_targets.config.
+type Policy struct {
+	// Mutations defaults to MutationsSkip.
+	Mutations MutationPolicy `json:"mutations,omitempty"`
+	// ReadOnlyPaths lists endpoints that only read, though their method
+	// says otherwise, like POST searches or gRPC getters. Patterns use
+	// path.Match syntax; a trailing "/**" matches the prefix and everything
+	// below it.
+	ReadOnlyPaths []string `json:"read_only_paths,omitempty"`
+}
+
+// RetryPolicy is the retry_policy object in shadow_targets.config. A task
+// whose failed requests all failed with a retryable error class is queued
+// again after an exponential backoff.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt; zero or one means no retries
+	// after errors. When set it also caps the attempts of a task whose
+	// worker lost its lease, in place of the worker's default.
+	MaxAttempts      int `json:"max_attempts,omitempty"`
+	InitialBackoffMS int `json:"initial_backoff_ms,omitempty"`
+	MaxBackoffMS     int `json:"max_backoff_ms,omitempty"`
+	// RetryOn lists the retryable error classes: "timeout",
+	// "connection_refused", "connection_reset", "transport" and
+	// "server_error" for 5xx responses. It defaults to timeouts, refused
+	// connections and 5xx responses.
+	RetryOn []string `json:"retry_on,omitempty"`
+}
+
+// Replay strategies, from shadow_targets.replay_strategy. Any value other
+// than StrategyThreeWay replays against the target alone.
+const (
+	StrategySingle = "single"
+	// StrategyThreeWay sends each request to the target and to two baseline
+	// instances and diffs the target against the first baseline. Where the
+	// baselines differ from each other is noise.
+	StrategyThreeWay = "three_way"
+)
+
+// ShadowTarget is the part of a shadow_targets row replay needs. TargetURL
+// is the base_url from the target environment's metadata; BaselineURLs,
+// Policy, Retry and Schedules come from the target's config.
+type ShadowTarget struct {
+	ID                  string
+	ProjectID           string
+	SourceEnvironmentID string
+	TargetEnvironmentID string
+	Status              string
+	ReplayStrategy      string
+	DiffStrategy        string
+	TargetURL           string
+	BaselineURLs        []string
+	Policy              Policy
+	Retry               RetryPolicy
+	Schedules           []Schedule
+}
+
+// Schedule is an entry of the schedules array in shadow_targets.config: a
+// job started every time Cron fires.
+type Schedule struct {
+	// Name tells the target's schedules apart; each run of a schedule
+	// starts one job.
+	Name string `json:"name"`
+	// Cron has five fields, minute, hour, day of month, month and day of
+	// week, or is one of @hourly, @daily, @weekly, @monthly and @yearly.
+	// It is read in Timezone, an IANA name, and in UTC without one.
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone,omitempty"`
+	// WindowSeconds, if set, replays the sessions that started within that
+	// long before the run, in place of Params.From and Params.To.
+	WindowSeconds      int       `json:"window_seconds,omitempty"`
+	TransformRuleSetID string    `json:"transform_rule_set_id,omitempty"`
+	Params             JobParams `json:"params"`
+	Disabled           bool      `json:"disabled,omitempty"`
+}
+
+// TaskCounts tallies a job's tasks by status.
+type TaskCounts map[Status]int
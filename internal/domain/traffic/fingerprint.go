@@ -0,0 +1,144 @@
+package traffic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSegment     = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+type FingerprintOptions struct {
+	// Headers whose values take part in the fingerprint, e.g. Accept.
+	Headers []string
+	// IgnoreQueryKeys are volatile query parameters such as cache busters.
+	IgnoreQueryKeys []string
+	// VolatileSegments are extra patterns for path segments that carry
+	// identifiers. Numeric IDs, UUIDs and long hex strings are always
+	// recognised.
+	VolatileSegments []string
+}
+
+// Fingerprinter reduces requests to the endpoint they hit: method, route
+// template, sorted query keys and selected headers. Requests with the same
+// fingerprint exercise the same code path.
+type Fingerprinter struct {
+	headers     []string
+	ignoreQuery map[string]struct{}
+	volatile    []*regexp.Regexp
+}
+
+func NewFingerprinter(opts FingerprintOptions) (*Fingerprinter, error) {
+	f := &Fingerprinter{ignoreQuery: make(map[string]struct{})}
+	for _, h := range opts.Headers {
+		if h = strings.TrimSpace(h); h != "" {
+			f.headers = append(f.headers, http.CanonicalHeaderKey(h))
+		}
+	}
+	sort.Strings(f.headers)
+	for _, k := range opts.IgnoreQueryKeys {
+		if k = strings.TrimSpace(k); k != "" {
+			f.ignoreQuery[k] = struct{}{}
+		}
+	}
+	for _, p := range opts.VolatileSegments {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("volatile segment pattern %q: %w", p, err)
+		}
+		f.volatile = append(f.volatile, re)
+	}
+	return f, nil
+}
+
+// RouteTemplate replaces identifier-like path segments with placeholders,
+// e.g. /orders/123/items/9f1c... becomes /orders/{id}/items/{hex}.
+func (f *Fingerprinter) RouteTemplate(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		switch {
+		case seg == "":
+		case numericSegment.MatchString(seg):
+			segments[i] = "{id}"
+		case uuidSegment.MatchString(seg):
+			segments[i] = "{uuid}"
+		case hexSegment.MatchString(seg):
+			segments[i] = "{hex}"
+		default:
+			for _, re := range f.volatile {
+				if re.MatchString(seg) {
+					segments[i] = "{var}"
+					break
+				}
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Endpoint is the human-readable form used to label fingerprint groups.
+func (f *Fingerprinter) Endpoint(method, p string) string {
+	return strings.ToUpper(method) + " " + f.RouteTemplate(p)
+}
+
+func (f *Fingerprinter) Fingerprint(method, p, rawQuery string, headers http.Header) string {
+	var b strings.Builder
+	b.WriteString(f.Endpoint(method, p))
+	b.WriteString("\n")
+	b.WriteString(strings.Join(f.queryKeys(rawQuery), "&"))
+	f.writeHeaders(&b, headers)
+	return digest(b.String())
+}
+
+// DedupKey identifies a request exactly, apart from ignored query keys and
+// unselected headers. Unlike the fingerprint it keeps query values and the
+// body hash.
+func (f *Fingerprinter) DedupKey(method, p, rawQuery string, headers http.Header, bodyHash string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(method) + " " + p + "\n")
+	values, _ := url.ParseQuery(rawQuery)
+	for _, k := range f.queryKeys(rawQuery) {
+		vs := values[k]
+		sort.Strings(vs)
+		b.WriteString(k + "=" + strings.Join(vs, ",") + "&")
+	}
+	f.writeHeaders(&b, headers)
+	b.WriteString("\n" + bodyHash)
+	return digest(b.String())
+}
+
+func (f *Fingerprinter) queryKeys(rawQuery string) []string {
+	values, _ := url.ParseQuery(rawQuery)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if _, ignored := f.ignoreQuery[k]; ignored {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *Fingerprinter) writeHeaders(b *strings.Builder, headers http.Header) {
+	for _, h := range f.headers {
+		b.WriteString("\n" + strings.ToLower(h) + ":" + strings.TrimSpace(strings.Join(headers.Values(h), ",")))
+	}
+}
+
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,59 @@
+package traffic
+
+// CapturePolicy controls which proxied requests are recorded. It is stored
+// as JSON under "capture_policy" in environments.metadata and may be
+// overridden per shadow target in shadow_targets.config.
+type CapturePolicy struct {
+	// SamplePercent is the share of sessions to capture, 0-100. Sampling is
+	// decided per session key, so a sampled session is captured in full.
+	// Nil captures everything.
+	SamplePercent *float64 `json:"sample_percent,omitempty"`
+
+	IncludeMethods []string `json:"include_methods,omitempty"`
+	ExcludeMethods []string `json:"exclude_methods,omitempty"`
+	// Path patterns use path.Match syntax; a trailing "/**" matches the
+	// prefix and everything below it.
+	IncludePaths []string `json:"include_paths,omitempty"`
+	ExcludePaths []string `json:"exclude_paths,omitempty"`
+
+	// MaxBodyBytes caps how much of each body is kept. Larger bodies are
+	// truncated and flagged.
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+
+	RouteLimits []RouteLimit `json:"route_limits,omitempty"`
+}
+
+// RouteLimit caps the capture rate of matching requests. An empty Method
+// matches any method.
+type RouteLimit struct {
+	Method string  `json:"method,omitempty"`
+	Path   string  `json:"path"`
+	RPS    float64 `json:"rps"`
+	Burst  int     `json:"burst,omitempty"`
+}
+
+// Merge returns p with every field that override sets replaced.
+func (p CapturePolicy) Merge(override CapturePolicy) CapturePolicy {
+	if override.SamplePercent != nil {
+		p.SamplePercent = override.SamplePercent
+	}
+	if override.IncludeMethods != nil {
+		p.IncludeMethods = override.IncludeMethods
+	}
+	if override.ExcludeMethods != nil {
+		p.ExcludeMethods = override.ExcludeMethods
+	}
+	if override.IncludePaths != nil {
+		p.IncludePaths = override.IncludePaths
+	}
+	if override.ExcludePaths != nil {
+		p.ExcludePaths = override.ExcludePaths
+	}
+	if override.MaxBodyBytes > 0 {
+		p.MaxBodyBytes = override.MaxBodyBytes
+	}
+	if override.RouteLimits != nil {
+		p.RouteLimits = override.RouteLimits
+	}
+	return p
+}
@@ -1,13 +1,152 @@
 package traffic
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
 
 type CaptureID string
 
+type SessionID string
+
+type Protocol string
+
+const (
+	ProtocolHTTP      Protocol = "http"
+	ProtocolGRPC      Protocol = "grpc"
+	ProtocolWebSocket Protocol = "websocket"
+)
+
+// GRPCCall identifies a unary gRPC call. Request and response bodies of a
+// gRPC exchange hold the unframed protobuf message.
+type GRPCCall struct {
+	Service string
+	Method  string
+}
+
+type FrameDirection string
+
+const (
+	FrameFromClient FrameDirection = "client"
+	FrameFromServer FrameDirection = "server"
+)
+
+// Frame is one WebSocket message of a recorded connection, reassembled from
+// its fragments. Offset is measured from the completed upgrade; Opcode is
+// the RFC 6455 opcode (1 text, 2 binary, 8 close, 9 ping, 10 pong).
+type Frame struct {
+	Offset    time.Duration
+	Direction FrameDirection
+	Opcode    int
+	Body      Body
+}
+
+// Session is a traffic_sessions row: requests from one external session,
+// replayed in the order they were captured.
+type Session struct {
+	ID                 SessionID
+	ProjectID          string
+	EnvironmentID      string
+	ShadowTargetID     string
+	ExternalSessionKey string
+	Status             string
+	StartedAt          time.Time
+	EndedAt            *time.Time
+}
+
+// CapturedTraffic is one recorded request/response exchange. Method and URL
+// are kept at the top level for convenience; the full request and the
+// original response live in Request and Response.
 type CapturedTraffic struct {
-	ID        CaptureID
+	ID         CaptureID
 	CapturedAt time.Time
 
-	Method string
-	URL    string
+	ProjectID      string
+	EnvironmentID  string
+	ShadowTargetID string
+
+	SessionID          SessionID
+	ExternalSessionKey string
+	// SequenceNo numbers a session's requests in the order they were
+	// captured, however late a request is stored.
+	SequenceNo int
+
+	// Protocol is empty for plain HTTP.
+	Protocol Protocol
+	Method   string
+	URL      string
+	GRPC     *GRPCCall
+	// Fingerprint groups requests hitting the same endpoint; see
+	// Fingerprinter.
+	Fingerprint string
+
+	Request  Request
+	Response Response
+	Latency  time.Duration
+	// Frames holds the messages of a WebSocket connection, in the order
+	// they crossed the proxy. The upgrade is Request and Response.
+	Frames []Frame
+
+	// ClientIP is only populated in memory; capture replaces it with
+	// ClientIPHash before the record leaves the process.
+	ClientIP     string
+	ClientIPHash string
+}
+
+type Request struct {
+	Scheme      string
+	Host        string
+	Path        string
+	QueryString string
+	Headers     http.Header
+	Body        Body
+}
+
+type Response struct {
+	StatusCode int
+	Headers    http.Header
+	Trailers   http.Header
+	Body       Body
+}
+
+// Body carries a payload inline in Data or, once offloaded, by reference in
+// Ref. Size is the full payload length even when Data was truncated.
+type Body struct {
+	Data      []byte
+	Ref       string
+	Hash      string
+	Size      int64
+	Truncated bool
+}
+
+func (b Body) Empty() bool {
+	return b.Size == 0 && len(b.Data) == 0 && b.Ref == ""
+}
+
+// Unrecorded reports whether only the payload's size is known, as for
+// responses imported from access logs: there are neither bytes nor a hash
+// to compare against.
+func (b Body) Unrecorded() bool {
+	return b.Size > 0 && b.Hash == "" && len(b.Data) == 0 && b.Ref == ""
+}
+
+// NewBody keeps at most limit bytes of data inline; Hash and Size always
+// describe the full payload. A limit of zero or less keeps everything.
+func NewBody(data []byte, limit int64) Body {
+	if len(data) == 0 {
+		return Body{}
+	}
+	b := Body{Data: data, Hash: HashBody(data), Size: int64(len(data))}
+	if limit > 0 && b.Size > limit {
+		b.Data = data[:limit]
+		b.Truncated = true
+	}
+	return b
+}
+
+func HashBody(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,54 @@
+package transform
+
+type RuleSetID string
+
+// ActionExtract takes a value from each response a rule matches. Both the
+// captured and the replayed response are read; later requests of the same
+// session get the replayed value wherever they carried the captured one.
+const ActionExtract = "extract"
+
+// Source says where an extraction reads its value.
+type Source string
+
+const (
+	SourceBody   Source = "body"
+	SourceHeader Source = "header"
+)
+
+// RuleSet is a transform_rule_sets row with its enabled rules in order.
+type RuleSet struct {
+	ID        RuleSetID
+	ProjectID string
+	Name      string
+	Version   int
+	Status    string
+	Rules     []Rule
+}
+
+// Rule is a transform_rules row. Extract holds the action_config of
+// ActionExtract rules and is nil for other actions.
+type Rule struct {
+	ID         string
+	OrderNo    int
+	Match      Match
+	ActionType string
+	Extract    *Extraction
+}
+
+// Match is stored in transform_rules.match_criteria. Empty fields match
+// anything; Path is a path.Match pattern such as "/orders/*".
+type Match struct {
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+// Extraction is the action_config of an ActionExtract rule. Body values
+// are found by a JSONPath such as "$.data.orders[0].id", header values by
+// name. Pattern, a regular expression with one group, narrows the value
+// down, e.g. `^/orders/(\d+)$` on a Location header.
+type Extraction struct {
+	Source  Source `json:"source"`
+	Path    string `json:"path,omitempty"`
+	Header  string `json:"header,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+}
@@ -0,0 +1,200 @@
+package replay
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	appdiff "synthema/internal/app/diff"
+	appreplay "synthema/internal/app/replay"
+	"synthema/internal/domain/common"
+	domainreplay "synthema/internal/domain/replay"
+	appErrors "synthema/internal/errors"
+	"synthema/internal/http"
+)
+
+type JobHandler struct {
+	jobs  *appreplay.Service
+	diffs *appdiff.Service
+}
+
+func NewJobHandler(jobs *appreplay.Service, diffs *appdiff.Service) *JobHandler {
+	return &JobHandler{jobs: jobs, diffs: diffs}
+}
+
+type createJobRequest struct {
+	ShadowTargetID     string                 `json:"shadow_target_id"`
+	TransformRuleSetID string                 `json:"transform_rule_set_id"`
+	Params             domainreplay.JobParams `json:"params"`
+}
+
+type jobResponse struct {
+	ID                 string                      `json:"id"`
+	ProjectID          string                      `json:"project_id"`
+	ShadowTargetID     string                      `json:"shadow_target_id"`
+	TransformRuleSetID string                      `json:"transform_rule_set_id,omitempty"`
+	Status             domainreplay.Status         `json:"status"`
+	Params             domainreplay.JobParams      `json:"params"`
+	ErrorMessage       string                      `json:"error_message,omitempty"`
+	Summary            *domainreplay.JobSummary    `json:"summary,omitempty"`
+	ScheduleName       string                      `json:"schedule_name,omitempty"`
+	ScheduledFor       *time.Time                  `json:"scheduled_for,omitempty"`
+	RequestedAt        time.Time                   `json:"requested_at"`
+	StartedAt          *time.Time                  `json:"started_at,omitempty"`
+	FinishedAt         *time.Time                  `json:"finished_at,omitempty"`
+	Tasks              map[domainreplay.Status]int `json:"tasks,omitempty"`
+}
+
+func newJobResponse(j domainreplay.ReplayJob, counts domainreplay.TaskCounts) jobResponse {
+	return jobResponse{
+		ID:                 string(j.ID),
+		ProjectID:          j.ProjectID,
+		ShadowTargetID:     j.ShadowTargetID,
+		TransformRuleSetID: j.TransformRuleSetID,
+		Status:             j.Status,
+		Params:             j.Params,
+		ErrorMessage:       j.ErrorMessage,
+		Summary:            j.Summary,
+		ScheduleName:       j.ScheduleName,
+		ScheduledFor:       j.ScheduledFor,
+		RequestedAt:        j.RequestedAt,
+		StartedAt:          j.StartedAt,
+		FinishedAt:         j.FinishedAt,
+		Tasks:              counts,
+	}
+}
+
+// Create queues a replay job; a worker picks it up.
+func (h *JobHandler) Create(c *fiber.Ctx) error {
+	var req createJobRequest
+	if err := c.BodyParser(&req); err != nil {
+		return appErrors.InvalidRequest()
+	}
+	if req.ShadowTargetID == "" {
+		return appErrors.InvalidRequest()
+	}
+	job, err := h.jobs.CreateJob(c.UserContext(), req.ShadowTargetID, req.TransformRuleSetID, req.Params)
+	if err != nil {
+		return jobError(err)
+	}
+	return http.Success(c, fiber.StatusAccepted, "Replay job queued", newJobResponse(job, nil))
+}
+
+// Get reports a job's status, its tasks counted by status and, for load
+// jobs, what the run measured.
+func (h *JobHandler) Get(c *fiber.Ctx) error {
+	job, counts, err := h.jobs.Job(c.UserContext(), domainreplay.ReplayID(c.Params("id")))
+	if err != nil {
+		return jobError(err)
+	}
+	return http.Success(c, fiber.StatusOK, "Replay job", newJobResponse(job, counts))
+}
+
+type endpointResponse struct {
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Endpoint    string `json:"endpoint"`
+	Total       int    `json:"total"`
+	Matched     int    `json:"matched"`
+	Mismatched  int    `json:"mismatched"`
+	Errored     int    `json:"errored"`
+	Skipped     int    `json:"skipped"`
+}
+
+// Endpoints counts a job's diff outcomes per endpoint, the endpoints with
+// the most mismatches first.
+func (h *JobHandler) Endpoints(c *fiber.Ctx) error {
+	id := domainreplay.ReplayID(c.Params("id"))
+	if _, _, err := h.jobs.Job(c.UserContext(), id); err != nil {
+		return jobError(err)
+	}
+	groups, err := h.diffs.JobEndpoints(c.UserContext(), id)
+	if err != nil {
+		return jobError(err)
+	}
+	resp := make([]endpointResponse, 0, len(groups))
+	for _, g := range groups {
+		resp = append(resp, endpointResponse{
+			Fingerprint: g.Fingerprint,
+			Endpoint:    g.Endpoint,
+			Total:       g.Total,
+			Matched:     g.Matched,
+			Mismatched:  g.Mismatched,
+			Errored:     g.Errored,
+			Skipped:     g.Skipped,
+		})
+	}
+	return http.Success(c, fiber.StatusOK, "Replay job diffs by endpoint", resp)
+}
+
+type attemptResponse struct {
+	TaskID       string              `json:"task_id"`
+	Attempt      int                 `json:"attempt"`
+	Status       domainreplay.Status `json:"status"`
+	Worker       string              `json:"worker,omitempty"`
+	ErrorMessage string              `json:"error_message,omitempty"`
+	StartedAt    *time.Time          `json:"started_at,omitempty"`
+	FinishedAt   time.Time           `json:"finished_at"`
+}
+
+// Attempts lists how every attempt at the job's tasks ended, retries
+// included.
+func (h *JobHandler) Attempts(c *fiber.Ctx) error {
+	attempts, err := h.jobs.Attempts(c.UserContext(), domainreplay.ReplayID(c.Params("id")))
+	if err != nil {
+		return jobError(err)
+	}
+	resp := make([]attemptResponse, 0, len(attempts))
+	for _, a := range attempts {
+		resp = append(resp, attemptResponse{
+			TaskID:       string(a.TaskID),
+			Attempt:      a.Attempt,
+			Status:       a.Status,
+			Worker:       a.Worker,
+			ErrorMessage: a.ErrorMessage,
+			StartedAt:    a.StartedAt,
+			FinishedAt:   a.FinishedAt,
+		})
+	}
+	return http.Success(c, fiber.StatusOK, "Replay task attempts", resp)
+}
+
+// Cancel stops a job for good; its running tasks stop shortly after.
+func (h *JobHandler) Cancel(c *fiber.Ctx) error {
+	job, err := h.jobs.CancelJob(c.UserContext(), domainreplay.ReplayID(c.Params("id")))
+	if err != nil {
+		return jobError(err)
+	}
+	return http.Success(c, fiber.StatusOK, "Replay job canceled", newJobResponse(job, nil))
+}
+
+// Pause stops a job from replaying until it is resumed.
+func (h *JobHandler) Pause(c *fiber.Ctx) error {
+	job, err := h.jobs.PauseJob(c.UserContext(), domainreplay.ReplayID(c.Params("id")))
+	if err != nil {
+		return jobError(err)
+	}
+	return http.Success(c, fiber.StatusOK, "Replay job paused", newJobResponse(job, nil))
+}
+
+// Resume continues a paused job with its unfinished tasks.
+func (h *JobHandler) Resume(c *fiber.Ctx) error {
+	job, err := h.jobs.ResumeJob(c.UserContext(), domainreplay.ReplayID(c.Params("id")))
+	if err != nil {
+		return jobError(err)
+	}
+	return http.Success(c, fiber.StatusOK, "Replay job resumed", newJobResponse(job, nil))
+}
+
+func jobError(err error) error {
+	switch {
+	case errors.Is(err, common.ErrConflict):
+		return appErrors.Conflict("Replay job cannot change from its current status")
+	case errors.Is(err, common.ErrNotFound):
+		return appErrors.NotFound()
+	case errors.Is(err, common.ErrInvalidInput):
+		return appErrors.InvalidRequest()
+	default:
+		return appErrors.Internal(err)
+	}
+}
@@ -0,0 +1,48 @@
+package traffic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"synthema/internal/app/export"
+	"synthema/internal/domain/common"
+	domaintraffic "synthema/internal/domain/traffic"
+	appErrors "synthema/internal/errors"
+)
+
+type ExportHandler struct {
+	exporter *export.Service
+}
+
+func NewExportHandler(exporter *export.Service) *ExportHandler {
+	return &ExportHandler{exporter: exporter}
+}
+
+// Export downloads a captured session. The format query parameter selects
+// "har" (default) or "jsonl".
+func (h *ExportHandler) Export(c *fiber.Ctx) error {
+	format, err := export.ParseFormat(c.Query("format"))
+	if err != nil {
+		return appErrors.InvalidRequest()
+	}
+	sessionID := domaintraffic.SessionID(c.Params("id"))
+
+	var buf bytes.Buffer
+	if err := h.exporter.Export(c.UserContext(), &buf, sessionID, format); err != nil {
+		switch {
+		case errors.Is(err, common.ErrNotFound):
+			return appErrors.NotFound()
+		case errors.Is(err, common.ErrInvalidInput):
+			return appErrors.InvalidRequest()
+		default:
+			return appErrors.Internal(err)
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, format.ContentType())
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="session-%s.%s"`, sessionID, format))
+	return c.Status(fiber.StatusOK).Send(buf.Bytes())
+}
@@ -0,0 +1,11 @@
+package blob
+
+import "context"
+
+// Store keeps immutable payloads under content-derived keys. Get returns an
+// error wrapping common.ErrNotFound for unknown keys.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Exists(ctx context.Context, key string) (bool, error)
+}
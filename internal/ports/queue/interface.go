@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"time"
 
 	"synthema/internal/domain/traffic"
 )
@@ -9,3 +10,15 @@ import (
 type TrafficQueue interface {
 	EnqueueCapturedTraffic(ctx context.Context, t traffic.CapturedTraffic) error
 }
+
+// Delivery is a captured traffic record handed to a consumer. It stays
+// pending until acknowledged by ID.
+type Delivery struct {
+	ID      string
+	Traffic traffic.CapturedTraffic
+}
+
+type TrafficConsumer interface {
+	ReadCapturedTraffic(ctx context.Context, count int, block time.Duration) ([]Delivery, error)
+	AckCapturedTraffic(ctx context.Context, ids ...string) error
+}
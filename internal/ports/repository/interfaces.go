@@ -2,20 +2,90 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"synthema/internal/domain/diff"
 	"synthema/internal/domain/replay"
 	"synthema/internal/domain/traffic"
+	"synthema/internal/domain/transform"
 )
 
 type TrafficRepository interface {
 	SaveCapturedTraffic(ctx context.Context, t traffic.CapturedTraffic) error
+	SaveCapturedTrafficBatch(ctx context.Context, batch []traffic.CapturedTraffic) error
+	CloseIdleSessions(ctx context.Context, idleSince time.Time) (int64, error)
+
+	GetSession(ctx context.Context, id traffic.SessionID) (traffic.Session, error)
+	// ListSessionRequests returns the session's requests in sequence order,
+	// which is the order they were captured in.
+	// Bodies come back by reference only.
+	ListSessionRequests(ctx context.Context, id traffic.SessionID) ([]traffic.CapturedTraffic, error)
+}
+
+// CapturePolicyRepository loads the capture policy of a source environment,
+// with the shadow target's policy applied on top when one is given.
+type CapturePolicyRepository interface {
+	LoadCapturePolicy(ctx context.Context, environmentID, shadowTargetID string) (traffic.CapturePolicy, error)
 }
 
 type ReplayRepository interface {
 	SaveReplayJob(ctx context.Context, j replay.ReplayJob) error
+	GetReplayJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error)
+	SaveJobSummary(ctx context.Context, id replay.ReplayID, summary replay.JobSummary) error
+	CountTasks(ctx context.Context, id replay.ReplayID) (replay.TaskCounts, error)
+	GetShadowTarget(ctx context.Context, id string) (replay.ShadowTarget, error)
+
+	// SelectSessions returns the sessions of the environment a job's
+	// params pick, oldest first.
+	SelectSessions(ctx context.Context, environmentID string, p replay.JobParams) ([]traffic.SessionID, error)
+	// PlanQueuedJob locks the oldest queued job, stores the tasks plan
+	// returns for it and marks it running, all in one transaction. A plan
+	// error fails the job instead. ok is false when no job is queued.
+	PlanQueuedJob(ctx context.Context, plan func(replay.ReplayJob) ([]replay.Task, error)) (job replay.ReplayJob, ok bool, err error)
+	// ClaimTask leases the oldest queued task of a running job to owner,
+	// marks it running and returns it. Concurrent workers never claim the
+	// same task. ok is false when there is none.
+	ClaimTask(ctx context.Context, owner string, lease time.Duration) (task replay.Task, ok bool, err error)
+	// RenewLease extends the lease owner holds on a running task and
+	// returns the status of its job. It returns replay.ErrLeaseLost when
+	// owner no longer holds the lease.
+	RenewLease(ctx context.Context, id replay.TaskID, owner string, lease time.Duration) (replay.Status, error)
+	// RequeueExpired takes back running tasks whose lease expired. Tasks
+	// that reached the max_attempts of their shadow target's retry policy,
+	// or maxAttempts without one, fail; the others are queued again.
+	RequeueExpired(ctx context.Context, maxAttempts int) ([]replay.ExpiredTask, error)
+	// FinishTask records the outcome of a task t.LeaseOwner holds and ends
+	// the lease. It returns replay.ErrLeaseLost when the lease is gone.
+	FinishTask(ctx context.Context, t replay.Task) error
+	// FinishJob gives a running job its final status once none of its tasks
+	// is queued or running. done reports whether it did.
+	FinishJob(ctx context.Context, id replay.ReplayID) (status replay.Status, done bool, err error)
+	// CreateScheduledJob saves a job a schedule started, unless a job for
+	// the same schedule and run exists; it reports whether it saved one.
+	CreateScheduledJob(ctx context.Context, j replay.ReplayJob) (bool, error)
+	// ListScheduledTargets returns the active shadow targets with schedules.
+	ListScheduledTargets(ctx context.Context) ([]replay.ShadowTarget, error)
+	// ListAttempts returns the recorded attempts of a job's tasks.
+	ListAttempts(ctx context.Context, id replay.ReplayID) ([]replay.TaskAttempt, error)
+	// PauseJob, ResumeJob and CancelJob change a job's status. They return
+	// common.ErrConflict when its current status does not allow it.
+	PauseJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error)
+	ResumeJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error)
+	CancelJob(ctx context.Context, id replay.ReplayID) (replay.ReplayJob, error)
+	// ListTaskResults returns the last result of each request the task
+	// has replayed, over all its attempts.
+	ListTaskResults(ctx context.Context, id replay.TaskID) ([]replay.Result, error)
+	SaveResult(ctx context.Context, r replay.Result) error
+}
+
+// TransformRepository loads a rule set with its enabled rules in order.
+type TransformRepository interface {
+	GetRuleSet(ctx context.Context, id transform.RuleSetID) (transform.RuleSet, error)
 }
 
 type DiffRepository interface {
 	SaveDiffResult(ctx context.Context, r diff.DiffResult) error
+	// ListJobDiffResults returns the diff results of a job, only the last
+	// attempt's for a request replayed more than once.
+	ListJobDiffResults(ctx context.Context, id replay.ReplayID) ([]diff.DiffResult, error)
 }
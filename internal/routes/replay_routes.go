@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	replayhandlers "synthema/internal/handlers/replay"
+)
+
+func RegisterReplayRoutes(api fiber.Router, jobHandler *replayhandlers.JobHandler) {
+	jobs := api.Group("/replay/jobs")
+	jobs.Post("/", jobHandler.Create)
+	jobs.Get("/:id", jobHandler.Get)
+	jobs.Get("/:id/attempts", jobHandler.Attempts)
+	jobs.Get("/:id/endpoints", jobHandler.Endpoints)
+	jobs.Post("/:id/cancel", jobHandler.Cancel)
+	jobs.Post("/:id/pause", jobHandler.Pause)
+	jobs.Post("/:id/resume", jobHandler.Resume)
+}
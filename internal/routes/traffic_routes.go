@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	traffichandlers "synthema/internal/handlers/traffic"
+)
+
+func RegisterTrafficRoutes(api fiber.Router, exportHandler *traffichandlers.ExportHandler) {
+	sessions := api.Group("/traffic/sessions")
+	sessions.Get("/:id/export", exportHandler.Export)
+}
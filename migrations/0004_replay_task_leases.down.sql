@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_replay_tasks_status_lease_expires_at;
+
+ALTER TABLE replay_tasks
+    DROP COLUMN IF EXISTS lease_owner,
+    DROP COLUMN IF EXISTS lease_expires_at;
+
+COMMIT;
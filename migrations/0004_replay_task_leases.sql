@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE replay_tasks
+    ADD COLUMN IF NOT EXISTS lease_owner TEXT,
+    ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_replay_tasks_status_lease_expires_at ON replay_tasks (status, lease_expires_at);
+
+COMMIT;
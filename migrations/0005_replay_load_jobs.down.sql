@@ -0,0 +1,14 @@
+BEGIN;
+
+DELETE FROM replay_tasks WHERE task_type = 'load';
+
+ALTER TABLE replay_tasks
+    DROP CONSTRAINT IF EXISTS replay_tasks_type_check;
+
+ALTER TABLE replay_tasks
+    ADD CONSTRAINT replay_tasks_type_check CHECK (task_type IN ('session', 'batch'));
+
+ALTER TABLE replay_jobs
+    DROP COLUMN IF EXISTS summary;
+
+COMMIT;
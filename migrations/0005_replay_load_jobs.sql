@@ -0,0 +1,12 @@
+BEGIN;
+
+ALTER TABLE replay_jobs
+    ADD COLUMN IF NOT EXISTS summary JSONB;
+
+ALTER TABLE replay_tasks
+    DROP CONSTRAINT IF EXISTS replay_tasks_type_check;
+
+ALTER TABLE replay_tasks
+    ADD CONSTRAINT replay_tasks_type_check CHECK (task_type IN ('session', 'batch', 'load'));
+
+COMMIT;
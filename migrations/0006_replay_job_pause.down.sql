@@ -0,0 +1,13 @@
+BEGIN;
+
+UPDATE replay_jobs
+SET status = CASE WHEN started_at IS NULL THEN 'queued' ELSE 'running' END
+WHERE status = 'paused';
+
+ALTER TABLE replay_jobs
+    DROP CONSTRAINT IF EXISTS replay_jobs_status_check;
+
+ALTER TABLE replay_jobs
+    ADD CONSTRAINT replay_jobs_status_check CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'canceled'));
+
+COMMIT;
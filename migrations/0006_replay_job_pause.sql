@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE replay_jobs
+    DROP CONSTRAINT IF EXISTS replay_jobs_status_check;
+
+ALTER TABLE replay_jobs
+    ADD CONSTRAINT replay_jobs_status_check CHECK (status IN ('queued', 'running', 'paused', 'succeeded', 'failed', 'canceled'));
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_replay_tasks_status_scheduled_at;
+
+ALTER TABLE replay_results
+  DROP COLUMN IF EXISTS attempt;
+
+DROP TABLE IF EXISTS replay_task_attempts;
+
+COMMIT;
@@ -0,0 +1,33 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS replay_task_attempts (
+  replay_task_id UUID NOT NULL,
+  attempt INTEGER NOT NULL,
+  status VARCHAR(32) NOT NULL,
+  worker TEXT,
+  error_message TEXT,
+  started_at TIMESTAMPTZ,
+  finished_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (replay_task_id, attempt)
+);
+
+ALTER TABLE replay_task_attempts
+  DROP CONSTRAINT IF EXISTS replay_task_attempts_status_check;
+
+ALTER TABLE replay_task_attempts
+  ADD CONSTRAINT replay_task_attempts_status_check CHECK (status IN ('succeeded', 'failed', 'canceled'));
+
+ALTER TABLE replay_task_attempts
+  DROP CONSTRAINT IF EXISTS replay_task_attempts_replay_task_id_fkey;
+
+ALTER TABLE replay_task_attempts
+  ADD CONSTRAINT replay_task_attempts_replay_task_id_fkey
+  FOREIGN KEY (replay_task_id) REFERENCES replay_tasks (id) ON DELETE RESTRICT;
+
+ALTER TABLE replay_results
+  ADD COLUMN IF NOT EXISTS attempt INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_replay_tasks_status_scheduled_at ON replay_tasks (status, scheduled_at);
+
+COMMIT;
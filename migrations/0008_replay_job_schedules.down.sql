@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_shadow_targets_scheduled;
+
+DROP INDEX IF EXISTS idx_replay_jobs_schedule_unique;
+
+ALTER TABLE replay_jobs
+  DROP COLUMN IF EXISTS schedule_name,
+  DROP COLUMN IF EXISTS scheduled_for;
+
+COMMIT;
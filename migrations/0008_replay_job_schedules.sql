@@ -0,0 +1,14 @@
+BEGIN;
+
+ALTER TABLE replay_jobs
+  ADD COLUMN IF NOT EXISTS schedule_name TEXT,
+  ADD COLUMN IF NOT EXISTS scheduled_for TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_replay_jobs_schedule_unique
+  ON replay_jobs (shadow_target_id, schedule_name, scheduled_for)
+  WHERE schedule_name IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_shadow_targets_scheduled ON shadow_targets (id)
+  WHERE deleted_at IS NULL AND config ? 'schedules';
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_traffic_requests_session_captured_at;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS idx_traffic_requests_session_captured_at
+  ON traffic_requests (session_id, captured_at, sequence_no);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE traffic_requests
+  DROP CONSTRAINT IF EXISTS traffic_requests_session_sequence_unique;
+
+ALTER TABLE traffic_requests
+  ADD CONSTRAINT traffic_requests_session_sequence_unique UNIQUE (session_id, sequence_no);
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Late requests are slotted into their session by capture time, which
+-- renumbers the requests after them; uniqueness is checked at commit then.
+ALTER TABLE traffic_requests
+  DROP CONSTRAINT IF EXISTS traffic_requests_session_sequence_unique;
+
+ALTER TABLE traffic_requests
+  ADD CONSTRAINT traffic_requests_session_sequence_unique UNIQUE (session_id, sequence_no)
+  DEFERRABLE INITIALLY IMMEDIATE;
+
+COMMIT;
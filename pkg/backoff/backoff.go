@@ -0,0 +1,34 @@
+// Package backoff computes how long to wait before retrying.
+package backoff
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Exponential doubles the delay with every retry, from Initial up to Max.
+type Exponential struct {
+	Initial time.Duration
+	// Max caps the delay; zero leaves it uncapped.
+	Max time.Duration
+	// Jitter is the share of the delay, from 0 to 1, that is randomised so
+	// retries of work that failed together spread out.
+	Jitter float64
+}
+
+// Delay returns the wait before retry n, counting from 1.
+func (e Exponential) Delay(n int) time.Duration {
+	d := e.Initial
+	for i := 1; i < n && d < maxDuration/2 && (e.Max <= 0 || d < e.Max); i++ {
+		d *= 2
+	}
+	if e.Max > 0 && d > e.Max {
+		d = e.Max
+	}
+	if j := min(max(e.Jitter, 0), 1); j > 0 && d > 0 {
+		d -= time.Duration(rand.Float64() * j * float64(d))
+	}
+	return d
+}
+
+const maxDuration = time.Duration(1<<63 - 1)
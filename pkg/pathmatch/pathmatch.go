@@ -0,0 +1,19 @@
+// Package pathmatch matches URL paths against the patterns capture and
+// replay policies use.
+package pathmatch
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether p matches pattern, which uses path.Match syntax. A
+// trailing "/**" matches the prefix itself and everything below it. A
+// malformed pattern matches nothing.
+func Match(pattern, p string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+	ok, err := path.Match(pattern, p)
+	return err == nil && ok
+}